@@ -0,0 +1,17 @@
+variable "bucket" {
+  type = string
+}
+
+data "berglas_bucket_posture" "secrets" {
+  bucket = var.bucket
+}
+
+check "secrets_bucket_posture" {
+  assert {
+    condition     = !contains(["high", "medium"], data.berglas_bucket_posture.secrets.highest_severity)
+    error_message = join("\n", [
+      for f in data.berglas_bucket_posture.secrets.findings : "${f.severity}: ${f.message}"
+      if f.severity != "low"
+    ])
+  }
+}
@@ -0,0 +1,15 @@
+variable "bucket" {
+  type = string
+}
+
+data "berglas_expiring_secrets" "soon" {
+  bucket = var.bucket
+  within = "720h"
+}
+
+check "no_expired_secrets" {
+  assert {
+    condition     = alltrue([for s in data.berglas_expiring_secrets.soon.secrets : !s.expired])
+    error_message = "One or more secrets have expired."
+  }
+}
@@ -0,0 +1,30 @@
+variable "bucket" {
+  type = string
+}
+
+data "berglas_kubernetes_secret_manifest" "app" {
+  name      = "app"
+  namespace = "default"
+
+  secrets = {
+    "api-key"     = "${var.bucket}/service-apikey"
+    "db-password" = "berglas://${var.bucket}/db-password"
+    "vendor"      = "sm://my-project/vendor-token"
+  }
+}
+
+// TLS and image pull secrets are validated for their required keys.
+data "berglas_kubernetes_secret_manifest" "tls" {
+  name = "web-tls"
+  type = "kubernetes.io/tls"
+
+  secrets = {
+    "tls.crt" = "${var.bucket}/web/tls.crt"
+    "tls.key" = "${var.bucket}/web/tls.key"
+  }
+}
+
+resource "local_sensitive_file" "app" {
+  filename = "${path.module}/app-secret.yaml"
+  content  = data.berglas_kubernetes_secret_manifest.app.manifest_yaml
+}
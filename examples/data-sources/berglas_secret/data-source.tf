@@ -10,3 +10,39 @@ data "berglas_secret" "apikey" {
 output "demo" {
   value = data.berglas_secret.apikey.plaintext
 }
+
+// Secrets can also be read from Secret Manager.
+data "berglas_secret" "dbpass" {
+  project = "my-project"
+  name    = "db-password"
+}
+
+check "apikey_age" {
+  assert {
+    condition     = timecmp(timeadd(data.berglas_secret.apikey.created_at, "2160h"), plantimestamp()) > 0
+    error_message = "The API key is older than 90 days and should be rotated."
+  }
+}
+
+// Fields of a JSON secret can be referenced directly.
+data "berglas_secret" "db_credentials" {
+  bucket = var.bucket
+  name   = "db-credentials"
+}
+
+output "db_host" {
+  value     = data.berglas_secret.db_credentials.json["host"]
+  sensitive = true
+}
+
+// Whole .env files can be parsed into individual values.
+data "berglas_secret" "app_env" {
+  bucket = var.bucket
+  name   = "app-env"
+  format = "dotenv"
+}
+
+output "log_level" {
+  value     = data.berglas_secret.app_env.values["LOG_LEVEL"]
+  sensitive = true
+}
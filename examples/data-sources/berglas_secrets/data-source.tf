@@ -0,0 +1,17 @@
+variable "bucket" {
+  type = string
+}
+
+data "berglas_secrets" "payments" {
+  bucket = var.bucket
+  prefix = "payments/"
+
+  labels = {
+    team = "payments"
+  }
+}
+
+// Each id can be used directly in an import block for berglas_secret.
+output "import_ids" {
+  value = { for s in data.berglas_secrets.payments.secrets : s.name => s.id }
+}
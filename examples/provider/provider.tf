@@ -1,2 +1,24 @@
 // Automatically find credentials (preferred).
 provider "berglas" {}
+
+// Store secrets on disk for offline development and `terraform test`.
+provider "berglas" {
+  alias           = "local"
+  backend         = "local"
+  local_directory = "${path.root}/.berglas"
+}
+
+// Refuse to modify secrets, for example in a pipeline which only plans.
+provider "berglas" {
+  alias     = "read_only"
+  read_only = true
+}
+
+// Only allow secrets in production buckets, under a team prefix, and encrypted
+// with keys in the production key ring.
+provider "berglas" {
+  alias                 = "restricted"
+  allowed_buckets       = ["prod-*"]
+  allowed_name_prefixes = ["payments/"]
+  allowed_kms_keys      = ["/^projects/my-project/locations/global/keyRings/prod/cryptoKeys/.+$/"]
+}
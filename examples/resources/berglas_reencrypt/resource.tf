@@ -0,0 +1,18 @@
+variable "bucket" {
+  type = string
+}
+
+variable "kms_key" {
+  type = string
+}
+
+# Re-encrypt every secret under "prod/" with the primary version of the key.
+# After the key is rotated, the next apply re-encrypts the secrets again.
+# Any berglas_secret managing these objects refreshes to the re-encrypted
+# generation on its next plan. Set key on those secrets to the same key, since
+# a berglas_secret whose key differs from the refreshed key is replaced.
+resource "berglas_reencrypt" "prod" {
+  bucket = var.bucket
+  prefix = "prod/"
+  key    = var.kms_key
+}
@@ -6,9 +6,71 @@ variable "kms_key" {
   type = string
 }
 
+variable "db_password" {
+  type      = string
+  sensitive = true
+}
+
+variable "vendor_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "legacy_api_key" {
+  type      = string
+  sensitive = true
+}
+
 resource "berglas_secret" "apikey" {
   bucket    = var.bucket
   name      = "service-apikey"
   key       = var.kms_key
   plaintext = other_resource.thing // example
 }
+
+// Vendor token which expires 30 days after each write.
+resource "berglas_secret" "vendor_token" {
+  bucket    = var.bucket
+  name      = "vendor-token"
+  key       = var.kms_key
+  plaintext = var.vendor_token
+  ttl       = "720h"
+}
+
+// Database password which is regenerated every 90 days.
+resource "berglas_secret" "db_password" {
+  bucket = var.bucket
+  name   = "db-password"
+  key    = var.kms_key
+
+  generator {
+    length  = 32
+    special = false
+  }
+
+  rotation_period = "2160h"
+}
+
+// Database credentials stored as one JSON object.
+resource "berglas_secret" "db_credentials" {
+  bucket = var.bucket
+  name   = "db-credentials"
+  key    = var.kms_key
+
+  plaintext_json = {
+    host     = "db.internal"
+    user     = "app"
+    password = var.db_password
+  }
+}
+
+// Take over a secret which was created outside of Terraform. The apply fails
+// if the existing plaintext differs, instead of overwriting it.
+resource "berglas_secret" "legacy_api_key" {
+  bucket = var.bucket
+  name   = "legacy-api-key"
+  key    = var.kms_key
+
+  plaintext   = var.legacy_api_key
+  on_conflict = "adopt"
+}
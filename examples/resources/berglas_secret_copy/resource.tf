@@ -0,0 +1,32 @@
+variable "bucket" {
+  type = string
+}
+
+variable "dr_bucket" {
+  type = string
+}
+
+variable "dr_kms_key" {
+  type = string
+}
+
+# Keep a copy of the API key in the disaster recovery region, encrypted with a
+# regional key. Including the generation updates the copy in the same apply as
+# the source.
+resource "berglas_secret_copy" "apikey_dr" {
+  source = "${berglas_secret.apikey.id}#${berglas_secret.apikey.generation}"
+
+  bucket = var.dr_bucket
+  name   = berglas_secret.apikey.name
+  key    = var.dr_kms_key
+}
+
+# Secrets managed elsewhere are followed by name. When refresh finds a newer
+# source generation, the next apply updates the copy.
+resource "berglas_secret_copy" "vendor_dr" {
+  source = "${var.bucket}/vendor-token"
+
+  bucket = var.dr_bucket
+  name   = "vendor-token"
+  key    = var.dr_kms_key
+}
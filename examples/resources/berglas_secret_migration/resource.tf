@@ -0,0 +1,30 @@
+variable "bucket" {
+  type = string
+}
+
+variable "project" {
+  type = string
+}
+
+# Move every generation of the secret into Secret Manager and delete the
+# Cloud Storage object. First set deletion_protection = false on the
+# berglas_secret and apply. Then remove it from the configuration in the same
+# change as the migration so that it is not recreated.
+resource "berglas_secret_migration" "apikey" {
+  source        = "${var.bucket}/apikey"
+  project       = var.project
+  generations   = "all"
+  delete_source = true
+}
+
+removed {
+  from = berglas_secret.apikey
+
+  lifecycle {
+    destroy = false
+  }
+}
+
+output "apikey_reference" {
+  value = berglas_secret_migration.apikey.reference
+}
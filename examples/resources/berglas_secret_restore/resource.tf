@@ -0,0 +1,17 @@
+variable "bucket" {
+  type = string
+}
+
+variable "good_generation" {
+  type        = number
+  description = "Generation of the API key to roll back to"
+}
+
+# Roll the API key back to a known-good generation after a bad rotation. The
+# generation may be noncurrent or soft-deleted. Remove this resource once the
+# rollback is applied; destroying it leaves the restored secret in place.
+resource "berglas_secret_restore" "apikey_rollback" {
+  bucket     = var.bucket
+  name       = "apikey"
+  generation = var.good_generation
+}
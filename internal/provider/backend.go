@@ -0,0 +1,105 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/storage"
+)
+
+const (
+	backendGCS   = "gcs"
+	backendLocal = "local"
+)
+
+// backend stores and encrypts Berglas secrets. Secrets are described by Cloud
+// Storage object attributes regardless of where they are stored, and a missing
+// secret is reported as storage.ErrObjectNotExist.
+type backend interface {
+	// Create encrypts the plaintext with the key and writes a new secret. The
+	// metadata of the secret records the key version which was used. It
+	// returns errObjectExists if the secret already exists.
+	Create(ctx context.Context, bucket, object, key string, plaintext []byte) (*storage.ObjectAttrs, error)
+
+	// Update encrypts the plaintext with the key and writes a new generation of
+	// an existing secret, recording the key version like Create. The
+	// generation and metageneration are used as preconditions.
+	Update(ctx context.Context, bucket, object, key string, plaintext []byte,
+		generation, metageneration int64) (*storage.ObjectAttrs, error)
+
+	// Access decrypts the given generation of the secret, or the latest
+	// generation if generation is 0.
+	Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error)
+
+	// Attrs returns the attributes of the given generation of the secret, or
+	// the latest generation if generation is 0.
+	Attrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error)
+
+	// List returns the attributes of the latest generation of every object in
+	// the bucket which begins with prefix, sorted by name.
+	List(ctx context.Context, bucket, prefix string) ([]*storage.ObjectAttrs, error)
+
+	// Generations returns the attributes of every generation of the secret,
+	// oldest first.
+	Generations(ctx context.Context, bucket, object string) ([]*storage.ObjectAttrs, error)
+
+	// PatchMetadata sets the given metadata keys on the object, preserving any
+	// other keys. An empty value removes the key. The generation and
+	// metageneration are used as preconditions.
+	PatchMetadata(ctx context.Context, bucket, object string, generation, metageneration int64,
+		metadata map[string]string) (*storage.ObjectAttrs, error)
+
+	// Rewrap re-encrypts the data encryption key of the given secret generation
+	// with the primary version of key, without changing the ciphertext. It
+	// returns errObjectModified if the secret was modified concurrently, and
+	// the name of the key version which was used.
+	Rewrap(ctx context.Context, attrs *storage.ObjectAttrs, key string) (*storage.ObjectAttrs, string, error)
+
+	// Restore makes a copy of the given generation the live generation of the
+	// secret. The generation may be noncurrent, which requires object
+	// versioning, or soft-deleted. The live generation is used as a
+	// precondition, and restoring the live generation does nothing.
+	Restore(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error)
+
+	// SoftDeletedAttrs returns the attributes of a soft-deleted generation of
+	// the secret. Soft-deleted generations cannot be decrypted until they are
+	// restored.
+	SoftDeletedAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error)
+
+	// Delete deletes all generations of the secret.
+	Delete(ctx context.Context, bucket, object string) error
+
+	// PrimaryKeyVersion returns the name of the primary version of the key. It
+	// requires permission to read the key, which writes do not.
+	PrimaryKeyVersion(ctx context.Context, key string) (string, error)
+
+	// KeyVersion returns the key version with the given name. If the caller
+	// cannot view the key version, it returns nil.
+	KeyVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, error)
+
+	// BucketAttrs returns the attributes of the bucket.
+	BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error)
+
+	// BucketPolicy returns the members of each role in the IAM policy of the
+	// bucket, including members of conditional bindings.
+	BucketPolicy(ctx context.Context, bucket string) (map[string][]string, error)
+
+	// MissingBucketPermissions and MissingKeyPermissions return the subset of
+	// bucketPermissions and keyPermissions that the caller does not have.
+	MissingBucketPermissions(ctx context.Context, bucket string) ([]string, error)
+	MissingKeyPermissions(ctx context.Context, key string) ([]string, error)
+}
@@ -0,0 +1,451 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	kms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ backend = (*gcsBackend)(nil)
+
+// storageJSONEndpoint is the Cloud Storage JSON API, which is called directly
+// for operations the storage client does not support.
+const storageJSONEndpoint = "https://storage.googleapis.com/storage/v1"
+
+// gcsBackend stores secrets in Cloud Storage and encrypts them with Cloud KMS.
+// Reads go through the berglas client, and writes and everything berglas does
+// not expose use the underlying clients directly. httpClient is authenticated
+// for calling the JSON API.
+type gcsBackend struct {
+	client        *berglas.Client
+	storageClient *storage.Client
+	kmsClient     *kms.KeyManagementClient
+	httpClient    *http.Client
+}
+
+func (b *gcsBackend) Create(ctx context.Context, bucket, object, key string, plaintext []byte) (*storage.ObjectAttrs, error) {
+	attrs, err := b.encryptAndWrite(ctx, bucket, object, key, plaintext, storage.Conditions{
+		DoesNotExist: true,
+	})
+	if errors.Is(err, errObjectModified) {
+		return nil, errObjectExists
+	}
+	return attrs, err
+}
+
+func (b *gcsBackend) Update(ctx context.Context, bucket, object, key string, plaintext []byte,
+	generation, metageneration int64) (*storage.ObjectAttrs, error) {
+	return b.encryptAndWrite(ctx, bucket, object, key, plaintext, storage.Conditions{
+		GenerationMatch:     generation,
+		MetagenerationMatch: metageneration,
+	})
+}
+
+// encryptAndWrite writes a new generation of the secret in the same format as
+// berglas. It encrypts the data encryption key itself instead of going through
+// the berglas client, so the key version in the Encrypt response can be
+// recorded without the caller needing permission to read the key.
+func (b *gcsBackend) encryptAndWrite(ctx context.Context, bucket, object, key string, plaintext []byte,
+	conds storage.Conditions) (*storage.ObjectAttrs, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, fmt.Errorf("failed to generate dek: %w", err)
+	}
+
+	ciphertext, err := envelopeEncrypt(dek, plaintext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	encryptResp, err := b.kmsClient.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:                        key,
+		Plaintext:                   dek,
+		AdditionalAuthenticatedData: []byte(object),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt dek: %w", err)
+	}
+
+	w := b.storageClient.
+		Bucket(bucket).
+		Object(object).
+		If(conds).
+		NewWriter(ctx)
+	w.ChunkSize = berglas.ChunkSize
+	w.CacheControl = berglas.CacheControl
+
+	// Like berglas, every write replaces the object metadata.
+	w.Metadata = map[string]string{
+		berglas.MetadataIDKey:  "1",
+		berglas.MetadataKMSKey: trimKMSKeyVersion(key),
+		metadataKMSKeyVersion:  encryptResp.Name,
+	}
+
+	if _, err := w.Write(joinCiphertext(encryptResp.Ciphertext, ciphertext)); err != nil {
+		return nil, fmt.Errorf("failed to write secret: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		if httpStatusCode(err) == http.StatusPreconditionFailed {
+			return nil, errObjectModified
+		}
+		return nil, fmt.Errorf("failed to write secret: %w", err)
+	}
+	return w.Attrs(), nil
+}
+
+func (b *gcsBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	return b.client.Access(ctx, &berglas.AccessRequest{
+		Bucket:     bucket,
+		Object:     object,
+		Generation: generation,
+	})
+}
+
+func (b *gcsBackend) Attrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	handle := b.storageClient.Bucket(bucket).Object(object)
+	if generation != 0 {
+		handle = handle.Generation(generation)
+	}
+	return handle.Attrs(ctx)
+}
+
+func (b *gcsBackend) List(ctx context.Context, bucket, prefix string) ([]*storage.ObjectAttrs, error) {
+	var result []*storage.ObjectAttrs
+
+	it := b.storageClient.Bucket(bucket).Objects(ctx, &storage.Query{
+		Prefix: prefix,
+	})
+	for {
+		obj, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+func (b *gcsBackend) Generations(ctx context.Context, bucket, object string) ([]*storage.ObjectAttrs, error) {
+	var result []*storage.ObjectAttrs
+
+	it := b.storageClient.Bucket(bucket).Objects(ctx, &storage.Query{
+		Prefix:   object,
+		Versions: true,
+	})
+	for {
+		obj, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// The prefix also matches longer object names
+		if obj.Name != object {
+			continue
+		}
+		result = append(result, obj)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Generation < result[j].Generation
+	})
+	return result, nil
+}
+
+func (b *gcsBackend) PatchMetadata(ctx context.Context, bucket, object string, generation, metageneration int64,
+	metadata map[string]string) (*storage.ObjectAttrs, error) {
+	attrs, err := b.storageClient.
+		Bucket(bucket).
+		Object(object).
+		Generation(generation).
+		If(storage.Conditions{
+			GenerationMatch:     generation,
+			MetagenerationMatch: metageneration,
+		}).
+		Update(ctx, storage.ObjectAttrsToUpdate{
+			Metadata: metadata,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update object metadata: %w", err)
+	}
+	return attrs, nil
+}
+
+func (b *gcsBackend) Rewrap(ctx context.Context, attrs *storage.ObjectAttrs, key string) (*storage.ObjectAttrs, string, error) {
+	handle := b.storageClient.
+		Bucket(attrs.Bucket).
+		Object(attrs.Name)
+
+	r, err := handle.Generation(attrs.Generation).NewReader(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	if err := r.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to close reader: %w", err)
+	}
+
+	encDEK, ciphertext, err := splitCiphertext(data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	decryptResp, err := b.kmsClient.Decrypt(ctx, &kmspb.DecryptRequest{
+		Name:                        attrs.Metadata[berglas.MetadataKMSKey],
+		Ciphertext:                  encDEK,
+		AdditionalAuthenticatedData: []byte(attrs.Name),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt dek: %w", err)
+	}
+
+	encryptResp, err := b.kmsClient.Encrypt(ctx, &kmspb.EncryptRequest{
+		Name:                        key,
+		Plaintext:                   decryptResp.Plaintext,
+		AdditionalAuthenticatedData: []byte(attrs.Name),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt dek: %w", err)
+	}
+
+	w := handle.
+		If(storage.Conditions{
+			GenerationMatch:     attrs.Generation,
+			MetagenerationMatch: attrs.Metageneration,
+		}).
+		NewWriter(ctx)
+	w.ChunkSize = berglas.ChunkSize
+	w.CacheControl = berglas.CacheControl
+	w.Metadata = rewrapMetadata(attrs.Metadata, key, encryptResp.Name)
+
+	if _, err := w.Write(joinCiphertext(encryptResp.Ciphertext, ciphertext)); err != nil {
+		return nil, "", fmt.Errorf("failed to write secret: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		var terr *googleapi.Error
+		if errors.As(err, &terr) && terr.Code == http.StatusPreconditionFailed {
+			return nil, "", errObjectModified
+		}
+		return nil, "", fmt.Errorf("failed to write secret: %w", err)
+	}
+
+	return w.Attrs(), encryptResp.Name, nil
+}
+
+func (b *gcsBackend) Restore(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	handle := b.storageClient.Bucket(bucket).Object(object)
+
+	var live int64
+	current, err := handle.Attrs(ctx)
+	switch {
+	case err == nil:
+		if current.Generation == generation {
+			return current, nil
+		}
+		live = current.Generation
+	case !errors.Is(err, storage.ErrObjectNotExist):
+		return nil, fmt.Errorf("failed to read live generation: %w", err)
+	}
+
+	// A generation of 0 means the object must not exist.
+	conds := storage.Conditions{GenerationMatch: live}
+	if live == 0 {
+		conds = storage.Conditions{DoesNotExist: true}
+	}
+
+	// Noncurrent generations are copied over the live generation. The copy
+	// includes the metadata, so it is encrypted with the same key.
+	src := handle.Generation(generation)
+	_, err = src.Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return b.restoreSoftDeleted(ctx, bucket, object, generation, live)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read generation %d: %w", generation, err)
+	}
+
+	attrs, err := handle.If(conds).CopierFrom(src).Run(ctx)
+	if httpStatusCode(err) == http.StatusPreconditionFailed {
+		return nil, errObjectModified
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy generation %d: %w", generation, err)
+	}
+	return attrs, nil
+}
+
+// restoreSoftDeleted restores a soft-deleted generation with the JSON API,
+// since the storage client does not support it. live is the generation of the
+// live object, or 0 if there is none.
+func (b *gcsBackend) restoreSoftDeleted(ctx context.Context, bucket, object string, generation, live int64) (*storage.ObjectAttrs, error) {
+	u := fmt.Sprintf("%s/b/%s/o/%s/restore?%s", storageJSONEndpoint,
+		url.PathEscape(bucket), url.PathEscape(object), url.Values{
+			"generation":        {strconv.FormatInt(generation, 10)},
+			"ifGenerationMatch": {strconv.FormatInt(live, 10)},
+		}.Encode())
+
+	attrs, err := b.jsonObject(ctx, http.MethodPost, u)
+	if httpStatusCode(err) == http.StatusPreconditionFailed {
+		return nil, errObjectModified
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore generation %d: %w", generation, err)
+	}
+	return attrs, nil
+}
+
+func (b *gcsBackend) SoftDeletedAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	u := fmt.Sprintf("%s/b/%s/o/%s?%s", storageJSONEndpoint,
+		url.PathEscape(bucket), url.PathEscape(object), url.Values{
+			"generation":  {strconv.FormatInt(generation, 10)},
+			"softDeleted": {"true"},
+		}.Encode())
+
+	attrs, err := b.jsonObject(ctx, http.MethodGet, u)
+	if httpStatusCode(err) == http.StatusNotFound {
+		return nil, storage.ErrObjectNotExist
+	}
+	return attrs, err
+}
+
+// jsonObject makes a request to the JSON API which returns an object resource,
+// for operations the storage client does not support.
+func (b *gcsBackend) jsonObject(ctx context.Context, method, u string) (*storage.ObjectAttrs, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var obj struct {
+		Bucket         string            `json:"bucket"`
+		Name           string            `json:"name"`
+		Generation     int64             `json:"generation,string"`
+		Metageneration int64             `json:"metageneration,string"`
+		TimeCreated    time.Time         `json:"timeCreated"`
+		Updated        time.Time         `json:"updated"`
+		Metadata       map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("failed to parse object: %w", err)
+	}
+
+	return &storage.ObjectAttrs{
+		Bucket:         obj.Bucket,
+		Name:           obj.Name,
+		Generation:     obj.Generation,
+		Metageneration: obj.Metageneration,
+		Created:        obj.TimeCreated,
+		Updated:        obj.Updated,
+		Metadata:       obj.Metadata,
+	}, nil
+}
+
+func (b *gcsBackend) Delete(ctx context.Context, bucket, object string) error {
+	return b.client.Delete(ctx, &berglas.DeleteRequest{
+		Bucket: bucket,
+		Object: object,
+	})
+}
+
+func (b *gcsBackend) PrimaryKeyVersion(ctx context.Context, key string) (string, error) {
+	cryptoKey, err := b.kmsClient.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{
+		Name: key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get key %q: %w", key, err)
+	}
+
+	primary := cryptoKey.GetPrimary().GetName()
+	if primary == "" {
+		return "", fmt.Errorf("key %q does not have a primary version", key)
+	}
+	return primary, nil
+}
+
+func (b *gcsBackend) KeyVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, error) {
+	version, err := b.kmsClient.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{
+		Name: name,
+	})
+	if status.Code(err) == codes.PermissionDenied {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key version %q: %w", name, err)
+	}
+	return version, nil
+}
+
+func (b *gcsBackend) BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error) {
+	return b.storageClient.Bucket(bucket).Attrs(ctx)
+}
+
+func (b *gcsBackend) BucketPolicy(ctx context.Context, bucket string) (map[string][]string, error) {
+	// Version 3 policies are required to read buckets with conditional bindings.
+	policy, err := b.storageClient.Bucket(bucket).IAM().V3().Policy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	members := make(map[string][]string, len(policy.Bindings))
+	for _, binding := range policy.Bindings {
+		members[binding.Role] = append(members[binding.Role], binding.Members...)
+	}
+	return members, nil
+}
+
+func (b *gcsBackend) MissingBucketPermissions(ctx context.Context, bucket string) ([]string, error) {
+	return missingPermissions(ctx, b.storageClient.Bucket(bucket).IAM(), bucketPermissions)
+}
+
+func (b *gcsBackend) MissingKeyPermissions(ctx context.Context, key string) ([]string, error) {
+	return missingPermissions(ctx, b.kmsClient.ResourceIAM(key), keyPermissions)
+}
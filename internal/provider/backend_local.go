@@ -0,0 +1,587 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+)
+
+var _ backend = (*localBackend)(nil)
+
+// localBackend stores secrets as files in a directory. It is intended for
+// offline development and testing, not production use.
+//
+// Secrets use the same envelope format as berglas, but the data encryption
+// key is encrypted with a key derived from a local master key and the Cloud
+// KMS key name instead of with Cloud KMS. Each generation of a secret is a
+// file at:
+//
+//	<dir>/<bucket>/<escaped object>/<generation>.json
+//
+// Generations are never removed except by Delete, which emulates a bucket
+// with object versioning enabled.
+type localBackend struct {
+	lock      sync.Mutex
+	dir       string
+	masterKey []byte
+}
+
+// localObject is the on-disk representation of a secret generation.
+type localObject struct {
+	Generation     int64             `json:"generation"`
+	Metageneration int64             `json:"metageneration"`
+	Created        time.Time         `json:"created"`
+	Updated        time.Time         `json:"updated"`
+	Metadata       map[string]string `json:"metadata"`
+	Data           string            `json:"data"`
+}
+
+// newLocalBackend creates a local backend in dir. If masterKeyFile is empty, a
+// file in dir is used. The master key is generated if the file does not exist.
+func newLocalBackend(dir, masterKeyFile string) (*localBackend, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if masterKeyFile == "" {
+		masterKeyFile = filepath.Join(dir, ".master.key")
+	}
+
+	masterKey, err := loadMasterKey(masterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localBackend{
+		dir:       dir,
+		masterKey: masterKey,
+	}, nil
+}
+
+// loadMasterKey reads the base64-encoded 256-bit master key from path,
+// generating it if the file does not exist.
+func loadMasterKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, fmt.Errorf("failed to generate master key: %w", err)
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(key)
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write master key: %w", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode master key: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func (b *localBackend) Create(ctx context.Context, bucket, object, key string, plaintext []byte) (*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	generations, err := b.generations(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+	if len(generations) > 0 {
+		return nil, errObjectExists
+	}
+
+	return b.write(bucket, object, key, plaintext, 0)
+}
+
+func (b *localBackend) Update(ctx context.Context, bucket, object, key string, plaintext []byte,
+	generation, metageneration int64) (*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	current, err := b.load(bucket, object, 0)
+	if err != nil {
+		return nil, err
+	}
+	if (generation != 0 && current.Generation != generation) ||
+		(metageneration != 0 && current.Metageneration != metageneration) {
+		return nil, errObjectModified
+	}
+
+	return b.write(bucket, object, key, plaintext, current.Generation)
+}
+
+func (b *localBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	obj, err := b.load(bucket, object, generation)
+	if err != nil {
+		return nil, err
+	}
+
+	encDEK, ciphertext, err := splitCiphertext([]byte(obj.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	dek, err := envelopeDecrypt(b.wrappingKey(obj.Metadata[berglas.MetadataKMSKey]), encDEK, []byte(object))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt dek: %w", err)
+	}
+
+	plaintext, err := envelopeDecrypt(dek, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return plaintext, nil
+}
+
+func (b *localBackend) Attrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	obj, err := b.load(bucket, object, generation)
+	if err != nil {
+		return nil, err
+	}
+	return obj.attrs(bucket, object), nil
+}
+
+func (b *localBackend) List(ctx context.Context, bucket, prefix string) ([]*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(b.dir, bucket))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bucket: %w", err)
+	}
+
+	var result []*storage.ObjectAttrs
+	for _, entry := range entries {
+		object, err := url.PathUnescape(entry.Name())
+		if err != nil || !entry.IsDir() || !strings.HasPrefix(object, prefix) {
+			continue
+		}
+
+		obj, err := b.load(bucket, object, 0)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj.attrs(bucket, object))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (b *localBackend) Generations(ctx context.Context, bucket, object string) ([]*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	generations, err := b.generations(bucket, object)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*storage.ObjectAttrs, 0, len(generations))
+	for _, generation := range generations {
+		obj, err := b.load(bucket, object, generation)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj.attrs(bucket, object))
+	}
+	return result, nil
+}
+
+func (b *localBackend) PatchMetadata(ctx context.Context, bucket, object string, generation, metageneration int64,
+	metadata map[string]string) (*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	obj, err := b.load(bucket, object, generation)
+	if err != nil {
+		return nil, err
+	}
+	if obj.Metageneration != metageneration {
+		return nil, fmt.Errorf("failed to update object metadata: %w", errObjectModified)
+	}
+
+	if obj.Metadata == nil {
+		obj.Metadata = make(map[string]string, len(metadata))
+	}
+	for k, v := range metadata {
+		if v == "" {
+			delete(obj.Metadata, k)
+			continue
+		}
+		obj.Metadata[k] = v
+	}
+	obj.Metageneration++
+	obj.Updated = time.Now().UTC()
+
+	if err := b.save(bucket, object, obj); err != nil {
+		return nil, err
+	}
+	return obj.attrs(bucket, object), nil
+}
+
+func (b *localBackend) Rewrap(ctx context.Context, attrs *storage.ObjectAttrs, key string) (*storage.ObjectAttrs, string, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	bucket, object := attrs.Bucket, attrs.Name
+
+	current, err := b.load(bucket, object, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if current.Generation != attrs.Generation || current.Metageneration != attrs.Metageneration {
+		return nil, "", errObjectModified
+	}
+
+	encDEK, ciphertext, err := splitCiphertext([]byte(current.Data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	dek, err := envelopeDecrypt(b.wrappingKey(current.Metadata[berglas.MetadataKMSKey]), encDEK, []byte(object))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt dek: %w", err)
+	}
+
+	encDEK, err = envelopeEncrypt(b.wrappingKey(key), dek, []byte(object))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt dek: %w", err)
+	}
+
+	keyVersion := localKeyVersion(key)
+	now := time.Now().UTC()
+	obj := &localObject{
+		Generation:     nextGeneration(current.Generation, now),
+		Metageneration: 1,
+		Created:        now,
+		Updated:        now,
+		Metadata:       rewrapMetadata(current.Metadata, key, keyVersion),
+		Data:           string(joinCiphertext(encDEK, ciphertext)),
+	}
+	if err := b.save(bucket, object, obj); err != nil {
+		return nil, "", err
+	}
+	return obj.attrs(bucket, object), keyVersion, nil
+}
+
+func (b *localBackend) Restore(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	obj, err := b.load(bucket, object, generation)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := b.load(bucket, object, 0)
+	if err != nil {
+		return nil, err
+	}
+	if current.Generation == generation {
+		return current.attrs(bucket, object), nil
+	}
+
+	// Like a Cloud Storage copy, the data and metadata are unchanged.
+	now := time.Now().UTC()
+	restored := &localObject{
+		Generation:     nextGeneration(current.Generation, now),
+		Metageneration: 1,
+		Created:        now,
+		Updated:        now,
+		Metadata:       obj.Metadata,
+		Data:           obj.Data,
+	}
+	if err := b.save(bucket, object, restored); err != nil {
+		return nil, err
+	}
+	return restored.attrs(bucket, object), nil
+}
+
+// SoftDeletedAttrs always returns storage.ErrObjectNotExist, since generations
+// are never soft-deleted.
+func (b *localBackend) SoftDeletedAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	return nil, storage.ErrObjectNotExist
+}
+
+func (b *localBackend) Delete(ctx context.Context, bucket, object string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err := os.RemoveAll(b.objectDir(bucket, object)); err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+	return nil
+}
+
+func (b *localBackend) PrimaryKeyVersion(ctx context.Context, key string) (string, error) {
+	return localKeyVersion(key), nil
+}
+
+func (b *localBackend) KeyVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, error) {
+	return &kmspb.CryptoKeyVersion{
+		Name:  name,
+		State: kmspb.CryptoKeyVersion_ENABLED,
+	}, nil
+}
+
+// BucketAttrs describes a bucket with the settings berglas expects, since the
+// local backend has no bucket settings of its own.
+func (b *localBackend) BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error) {
+	return &storage.BucketAttrs{
+		Name:                     bucket,
+		UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+		PublicAccessPrevention:   storage.PublicAccessPreventionEnforced,
+		VersioningEnabled:        true,
+	}, nil
+}
+
+func (b *localBackend) BucketPolicy(ctx context.Context, bucket string) (map[string][]string, error) {
+	return map[string][]string{}, nil
+}
+
+func (b *localBackend) MissingBucketPermissions(ctx context.Context, bucket string) ([]string, error) {
+	return nil, nil
+}
+
+func (b *localBackend) MissingKeyPermissions(ctx context.Context, key string) ([]string, error) {
+	return nil, nil
+}
+
+// write encrypts the plaintext and saves it as a new generation. The caller
+// must hold the lock.
+func (b *localBackend) write(bucket, object, key string, plaintext []byte,
+	previous int64) (*storage.ObjectAttrs, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, fmt.Errorf("failed to generate dek: %w", err)
+	}
+
+	ciphertext, err := envelopeEncrypt(dek, plaintext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	encDEK, err := envelopeEncrypt(b.wrappingKey(key), dek, []byte(object))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt dek: %w", err)
+	}
+
+	now := time.Now().UTC()
+	obj := &localObject{
+		Generation:     nextGeneration(previous, now),
+		Metageneration: 1,
+		Created:        now,
+		Updated:        now,
+		Data:           string(joinCiphertext(encDEK, ciphertext)),
+
+		// Like berglas, every write replaces the object metadata.
+		Metadata: map[string]string{
+			berglas.MetadataIDKey:  "1",
+			berglas.MetadataKMSKey: trimKMSKeyVersion(key),
+			metadataKMSKeyVersion:  localKeyVersion(key),
+		},
+	}
+	if err := b.save(bucket, object, obj); err != nil {
+		return nil, err
+	}
+	return obj.attrs(bucket, object), nil
+}
+
+// load reads the given generation of the object, or the latest generation if
+// generation is 0. The caller must hold the lock.
+func (b *localBackend) load(bucket, object string, generation int64) (*localObject, error) {
+	if generation == 0 {
+		generations, err := b.generations(bucket, object)
+		if err != nil {
+			return nil, err
+		}
+		if len(generations) == 0 {
+			return nil, storage.ErrObjectNotExist
+		}
+		generation = generations[len(generations)-1]
+	}
+
+	data, err := os.ReadFile(b.generationPath(bucket, object, generation))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, storage.ErrObjectNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	var obj localObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to parse secret: %w", err)
+	}
+	return &obj, nil
+}
+
+// save writes the object generation, replacing any existing file atomically.
+// The caller must hold the lock.
+func (b *localBackend) save(bucket, object string, obj *localObject) error {
+	if err := os.MkdirAll(b.objectDir(bucket, object), 0o700); err != nil {
+		return fmt.Errorf("failed to create secret directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+
+	path := b.generationPath(bucket, object, obj.Generation)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+	return nil
+}
+
+// generations returns the generations of the object in ascending order. The
+// caller must hold the lock.
+func (b *localBackend) generations(bucket, object string) ([]int64, error) {
+	entries, err := os.ReadDir(b.objectDir(bucket, object))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list generations: %w", err)
+	}
+
+	generations := make([]int64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		generation, err := strconv.ParseInt(strings.TrimSuffix(name, ".json"), 10, 64)
+		if err != nil {
+			continue
+		}
+		generations = append(generations, generation)
+	}
+
+	sort.Slice(generations, func(i, j int) bool {
+		return generations[i] < generations[j]
+	})
+	return generations, nil
+}
+
+func (b *localBackend) objectDir(bucket, object string) string {
+	return filepath.Join(b.dir, bucket, url.PathEscape(object))
+}
+
+func (b *localBackend) generationPath(bucket, object string, generation int64) string {
+	return filepath.Join(b.objectDir(bucket, object), strconv.FormatInt(generation, 10)+".json")
+}
+
+// wrappingKey derives the key which encrypts data encryption keys for the
+// given Cloud KMS key, so that secrets can only be decrypted with the key they
+// were encrypted with.
+func (b *localBackend) wrappingKey(key string) []byte {
+	mac := hmac.New(sha256.New, b.masterKey)
+	mac.Write([]byte(trimKMSKeyVersion(key)))
+	return mac.Sum(nil)
+}
+
+// attrs returns the object attributes for the generation.
+func (o *localObject) attrs(bucket, object string) *storage.ObjectAttrs {
+	data := []byte(o.Data)
+	sum := md5.Sum(data)
+
+	metadata := make(map[string]string, len(o.Metadata))
+	for k, v := range o.Metadata {
+		metadata[k] = v
+	}
+
+	return &storage.ObjectAttrs{
+		Bucket:         bucket,
+		Name:           object,
+		Generation:     o.Generation,
+		Metageneration: o.Metageneration,
+		Created:        o.Created,
+		Updated:        o.Updated,
+		Metadata:       metadata,
+		Size:           int64(len(data)),
+		CRC32C:         crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)),
+		MD5:            sum[:],
+		StorageClass:   "STANDARD",
+		CacheControl:   berglas.CacheControl,
+	}
+}
+
+// localKeyVersion returns the name of the only version of a local key.
+func localKeyVersion(key string) string {
+	return trimKMSKeyVersion(key) + "/cryptoKeyVersions/1"
+}
+
+// nextGeneration returns a generation number after previous. Like Cloud
+// Storage, generations are based on the current time in microseconds.
+func nextGeneration(previous int64, now time.Time) int64 {
+	if g := now.UnixMicro(); g > previous {
+		return g
+	}
+	return previous + 1
+}
@@ -0,0 +1,288 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+)
+
+const testLocalKey = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+func testLocalBackend(tb testing.TB) *localBackend {
+	tb.Helper()
+
+	b, err := newLocalBackend(tb.TempDir(), "")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func TestLocalBackend_lifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := testLocalBackend(t)
+
+	created, err := b.Create(ctx, "bucket", "path/to/secret", testLocalKey, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := created.Metadata[berglas.MetadataKMSKey], testLocalKey; got != want {
+		t.Errorf("expected key %q to be %q", got, want)
+	}
+	if got, want := created.Metadata[metadataKMSKeyVersion], testLocalKey+"/cryptoKeyVersions/1"; got != want {
+		t.Errorf("expected key version %q to be %q", got, want)
+	}
+
+	if _, err := b.Create(ctx, "bucket", "path/to/secret", testLocalKey, []byte("again")); err == nil {
+		t.Error("expected error creating an existing secret")
+	}
+
+	// Stale preconditions are rejected
+	if _, err := b.Update(ctx, "bucket", "path/to/secret", testLocalKey, []byte("after"),
+		created.Generation+1, created.Metageneration); !errors.Is(err, errObjectModified) {
+		t.Errorf("expected %v to be %v", err, errObjectModified)
+	}
+
+	updated, err := b.Update(ctx, "bucket", "path/to/secret", testLocalKey, []byte("after"),
+		created.Generation, created.Metageneration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Generation <= created.Generation {
+		t.Errorf("expected generation %d to be after %d", updated.Generation, created.Generation)
+	}
+
+	generations, err := b.Generations(ctx, "bucket", "path/to/secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generations) != 2 || generations[0].Generation != created.Generation {
+		t.Errorf("expected generations %d and %d, got %v", created.Generation, updated.Generation, generations)
+	}
+
+	// Both generations are readable
+	for generation, want := range map[int64]string{
+		0:                  "after",
+		created.Generation: "before",
+		updated.Generation: "after",
+	} {
+		plaintext, err := b.Access(ctx, "bucket", "path/to/secret", generation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(plaintext); got != want {
+			t.Errorf("generation %d: expected %q to be %q", generation, got, want)
+		}
+	}
+
+	if err := b.Delete(ctx, "bucket", "path/to/secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Attrs(ctx, "bucket", "path/to/secret", 0); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Errorf("expected %v to be %v", err, storage.ErrObjectNotExist)
+	}
+}
+
+func TestLocalBackend_patchMetadata(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := testLocalBackend(t)
+
+	created, err := b.Create(ctx, "bucket", "secret", testLocalKey, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := b.PatchMetadata(ctx, "bucket", "secret", created.Generation, created.Metageneration,
+		map[string]string{"team": "payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := patched.Metageneration, created.Metageneration+1; got != want {
+		t.Errorf("expected metageneration %d to be %d", got, want)
+	}
+	if got, want := patched.Metadata["team"], "payments"; got != want {
+		t.Errorf("expected team %q to be %q", got, want)
+	}
+
+	// Stale metagenerations are rejected
+	if _, err := b.PatchMetadata(ctx, "bucket", "secret", created.Generation, created.Metageneration,
+		map[string]string{"team": "billing"}); !errors.Is(err, errObjectModified) {
+		t.Errorf("expected %v to be %v", err, errObjectModified)
+	}
+
+	// Empty values remove the key
+	cleared, err := b.PatchMetadata(ctx, "bucket", "secret", patched.Generation, patched.Metageneration,
+		map[string]string{"team": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cleared.Metadata["team"]; ok {
+		t.Errorf("expected team to be removed from %v", cleared.Metadata)
+	}
+}
+
+func TestLocalBackend_restore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := testLocalBackend(t)
+
+	created, err := b.Create(ctx, "bucket", "secret", testLocalKey, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := b.Update(ctx, "bucket", "secret", testLocalKey, []byte("after"), created.Generation, created.Metageneration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := b.Restore(ctx, "bucket", "secret", created.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Generation <= updated.Generation {
+		t.Errorf("expected generation %d to be after %d", restored.Generation, updated.Generation)
+	}
+
+	plaintext, err := b.Access(ctx, "bucket", "secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(plaintext), "before"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// Restoring the live generation does nothing
+	again, err := b.Restore(ctx, "bucket", "secret", restored.Generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := again.Generation, restored.Generation; got != want {
+		t.Errorf("expected generation %d to be %d", got, want)
+	}
+
+	if _, err := b.Restore(ctx, "bucket", "secret", 1); !errors.Is(err, storage.ErrObjectNotExist) {
+		t.Errorf("expected %v to be %v", err, storage.ErrObjectNotExist)
+	}
+}
+
+func TestLocalBackend_list(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := testLocalBackend(t)
+
+	for _, name := range []string{"prod/b", "prod/a", "dev/a"} {
+		if _, err := b.Create(ctx, "bucket", name, testLocalKey, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	objs, err := b.List(ctx, "bucket", "prod/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].Name != "prod/a" || objs[1].Name != "prod/b" {
+		t.Errorf("expected prod/a and prod/b, got %v", objs)
+	}
+
+	objs, err = b.List(ctx, "missing", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 0 {
+		t.Errorf("expected no objects, got %v", objs)
+	}
+}
+
+func TestLocalBackend_rewrap(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := testLocalBackend(t)
+	otherKey := testLocalKey + "-other"
+
+	created, err := b.Create(ctx, "bucket", "secret", testLocalKey, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrapped, version, err := b.Rewrap(ctx, created, otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := version, otherKey+"/cryptoKeyVersions/1"; got != want {
+		t.Errorf("expected version %q to be %q", got, want)
+	}
+	if got, want := rewrapped.Metadata[berglas.MetadataKMSKey], otherKey; got != want {
+		t.Errorf("expected key %q to be %q", got, want)
+	}
+
+	plaintext, err := b.Access(ctx, "bucket", "secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(plaintext), "value"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	// The original attributes are now stale
+	if _, _, err := b.Rewrap(ctx, created, otherKey); !errors.Is(err, errObjectModified) {
+		t.Errorf("expected %v to be %v", err, errObjectModified)
+	}
+}
+
+func TestLocalBackend_masterKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	b, err := newLocalBackend(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Create(ctx, "bucket", "secret", testLocalKey, []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The generated master key is reused
+	b, err = newLocalBackend(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Access(ctx, "bucket", "secret", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// A different master key cannot decrypt the secret
+	b, err = newLocalBackend(dir, filepath.Join(t.TempDir(), "other.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Access(ctx, "bucket", "secret", 0); err == nil {
+		t.Error("expected error decrypting with a different master key")
+	}
+}
@@ -15,21 +15,208 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"sync"
 
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"golang.org/x/sync/singleflight"
 )
 
 type config struct {
 	lock sync.RWMutex
 
-	client *berglas.Client
+	backend  backend
+	smClient *secretmanager.Client
+	readOnly bool
+
+	// newClients creates the Cloud Storage backend and the Secret Manager
+	// client on first use, so the provider can be configured without
+	// credentials. It is nil when using the local backend.
+	newClients func(ctx context.Context) (*gcsBackend, *secretmanager.Client, error)
+	clientsErr error
+
+	// logMasks are credential values which are masked in log output.
+	logMasks []string
+
+	guardrails *guardrails
+
+	// readCache enables caching decrypted secrets for the life of the
+	// provider. Entries are keyed by encodeId and only pinned generations are
+	// cached, since a generation never changes once it is written.
+	readCache  bool
+	cache      map[string][]byte
+	cacheGroup singleflight.Group
+}
+
+// Backend returns the configured secret storage backend, creating the clients
+// if needed. Every call to the backend is logged, and if the read cache is
+// enabled, reads of pinned generations are served from the cache.
+func (c *config) Backend(ctx context.Context) (backend, error) {
+	if err := c.loadClients(ctx); err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.backend == nil {
+		return nil, fmt.Errorf("provider is not configured")
+	}
+
+	var b backend = &loggingBackend{backend: c.backend}
+	if c.readCache {
+		b = &cachedBackend{backend: b, config: c}
+	}
+	return b, nil
 }
 
-// Client returns the configured berglas client.
-func (c *config) Client() *berglas.Client {
+// Client returns the berglas client, creating it if needed. It returns an
+// error when using the local backend.
+func (c *config) Client(ctx context.Context) (*berglas.Client, error) {
+	if err := c.loadClients(ctx); err != nil {
+		return nil, err
+	}
+
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 
-	return c.client
+	gcs, ok := c.backend.(*gcsBackend)
+	if !ok {
+		return nil, fmt.Errorf("Secret Manager secrets are not supported by the %q backend", backendLocal)
+	}
+	return gcs.client, nil
+}
+
+// SecretManagerClient returns the Secret Manager client, creating it if needed.
+// It returns an error when using the local backend.
+func (c *config) SecretManagerClient(ctx context.Context) (*secretmanager.Client, error) {
+	if err := c.loadClients(ctx); err != nil {
+		return nil, err
+	}
+
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.smClient == nil {
+		return nil, fmt.Errorf("Secret Manager secrets are not supported by the %q backend", backendLocal)
+	}
+	return c.smClient, nil
+}
+
+// loadClients creates the clients with newClients the first time it is called.
+// Errors, such as missing credentials, are returned on every call.
+func (c *config) loadClients(ctx context.Context) error {
+	c.lock.RLock()
+	pending, err := c.newClients != nil && c.backend == nil, c.clientsErr
+	c.lock.RUnlock()
+
+	if !pending || err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Another caller may have created the clients while waiting for the lock.
+	if c.backend != nil || c.clientsErr != nil {
+		return c.clientsErr
+	}
+
+	gcs, smClient, err := c.newClients(ctx)
+	if err != nil {
+		c.clientsErr = err
+		return err
+	}
+	c.backend, c.smClient = gcs, smClient
+	return nil
+}
+
+// ReadOnly returns true if resources must not mutate secrets.
+func (c *config) ReadOnly() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.readOnly
+}
+
+// Guardrails returns the configured restrictions on where secrets are written.
+func (c *config) Guardrails() *guardrails {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.guardrails
+}
+
+// cachedAccess returns the plaintext of the secret generation from the cache,
+// or reads it with access. Concurrent reads of the same generation share one
+// call to access.
+func (c *config) cachedAccess(bucket, object string, generation int64, access func() ([]byte, error)) ([]byte, error) {
+	key := encodeId(bucket, object, generation)
+
+	c.lock.RLock()
+	plaintext, ok := c.cache[key]
+	c.lock.RUnlock()
+	if ok {
+		return append([]byte(nil), plaintext...), nil
+	}
+
+	v, err, _ := c.cacheGroup.Do(key, func() (any, error) {
+		plaintext, err := access()
+		if err != nil {
+			return nil, err
+		}
+
+		c.lock.Lock()
+		if c.cache == nil {
+			c.cache = make(map[string][]byte)
+		}
+		c.cache[key] = plaintext
+		c.lock.Unlock()
+
+		return plaintext, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), v.([]byte)...), nil
+}
+
+// purgeCache removes every cached generation of the secret.
+func (c *config) purgeCache(bucket, object string) {
+	prefix := encodeId(bucket, object, 0) + "#"
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for k := range c.cache {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.cache, k)
+		}
+	}
+}
+
+// cachedBackend is a backend which serves reads of pinned generations from the
+// read cache of the config.
+type cachedBackend struct {
+	backend
+	config *config
+}
+
+func (b *cachedBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	// The latest generation may change at any time.
+	if generation == 0 {
+		return b.backend.Access(ctx, bucket, object, generation)
+	}
+
+	return b.config.cachedAccess(bucket, object, generation, func() ([]byte, error) {
+		return b.backend.Access(ctx, bucket, object, generation)
+	})
+}
+
+func (b *cachedBackend) Delete(ctx context.Context, bucket, object string) error {
+	defer b.config.purgeCache(bucket, object)
+	return b.backend.Delete(ctx, bucket, object)
 }
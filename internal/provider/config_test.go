@@ -0,0 +1,162 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+)
+
+// countingBackend counts calls to Access.
+type countingBackend struct {
+	backend
+	accesses int64
+}
+
+func (b *countingBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	atomic.AddInt64(&b.accesses, 1)
+
+	// Give concurrent readers a chance to pile up.
+	time.Sleep(10 * time.Millisecond)
+	return b.backend.Access(ctx, bucket, object, generation)
+}
+
+func TestConfig_readCache(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	counting := &countingBackend{backend: testLocalBackend(t)}
+	config := &config{backend: counting, readCache: true}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := backend.Create(ctx, "bucket", "secret", testLocalKey, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent reads of the same generation are deduplicated
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			plaintext, err := backend.Access(ctx, "bucket", "secret", created.Generation)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if got, want := string(plaintext), "value"; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := backend.Access(ctx, "bucket", "secret", created.Generation); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt64(&counting.accesses), int64(1); got != want {
+		t.Errorf("expected %d accesses to be %d", got, want)
+	}
+
+	// The latest generation is not cached
+	if _, err := backend.Access(ctx, "bucket", "secret", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := atomic.LoadInt64(&counting.accesses), int64(2); got != want {
+		t.Errorf("expected %d accesses to be %d", got, want)
+	}
+
+	// Deleted secrets are not served from the cache
+	if err := backend.Delete(ctx, "bucket", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Access(ctx, "bucket", "secret", created.Generation); err == nil {
+		t.Error("expected error reading a deleted secret")
+	}
+}
+
+func TestConfig_readCacheDisabled(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	counting := &countingBackend{backend: testLocalBackend(t)}
+	config := &config{backend: counting}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := backend.Create(ctx, "bucket", "secret", testLocalKey, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := backend.Access(ctx, "bucket", "secret", created.Generation); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := atomic.LoadInt64(&counting.accesses), int64(2); got != want {
+		t.Errorf("expected %d accesses to be %d", got, want)
+	}
+}
+
+func TestConfig_loadClients(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var calls int64
+	config := &config{
+		newClients: func(context.Context) (*gcsBackend, *secretmanager.Client, error) {
+			atomic.AddInt64(&calls, 1)
+			return nil, nil, fmt.Errorf("missing credentials")
+		},
+	}
+
+	// Clients are not created until they are used
+	if got, want := atomic.LoadInt64(&calls), int64(0); got != want {
+		t.Errorf("expected %d calls to be %d", got, want)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := config.Backend(ctx); err == nil || err.Error() != "missing credentials" {
+			t.Errorf("expected %v to be %q", err, "missing credentials")
+		}
+		if _, err := config.Client(ctx); err == nil {
+			t.Error("expected error creating client")
+		}
+		if _, err := config.SecretManagerClient(ctx); err == nil {
+			t.Error("expected error creating client")
+		}
+	}
+
+	// The error is cached
+	if got, want := atomic.LoadInt64(&calls), int64(1); got != want {
+		t.Errorf("expected %d calls to be %d", got, want)
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	severityHigh   = "high"
+	severityMedium = "medium"
+	severityLow    = "low"
+)
+
+// severityRank orders severities from least to most severe.
+var severityRank = map[string]int{
+	severityLow:    1,
+	severityMedium: 2,
+	severityHigh:   3,
+}
+
+var (
+	// publicMembers are IAM members which grant access to anyone.
+	publicMembers = map[string]bool{
+		"allUsers":              true,
+		"allAuthenticatedUsers": true,
+	}
+
+	// broadMemberPrefixes are prefixes of IAM members which grant access to
+	// every principal in a domain, project, or identity pool.
+	broadMemberPrefixes = []string{
+		"domain:",
+		"projectViewer:",
+		"projectEditor:",
+		"projectOwner:",
+		"principalSet:",
+	}
+
+	// objectReaderRoles are the predefined bucket roles which can read objects.
+	objectReaderRoles = map[string]bool{
+		"roles/storage.admin":              true,
+		"roles/storage.objectAdmin":        true,
+		"roles/storage.objectUser":         true,
+		"roles/storage.objectViewer":       true,
+		"roles/storage.legacyObjectOwner":  true,
+		"roles/storage.legacyObjectReader": true,
+	}
+)
+
+// postureFinding is a problem with the configuration of a secrets bucket.
+type postureFinding struct {
+	check    string
+	severity string
+	message  string
+	role     string
+	member   string
+}
+
+func dataSourceBerglasBucketPosture() *schema.Resource {
+	return &schema.Resource{
+		Description: "Inspect the security posture of a Cloud Storage bucket " +
+			"which stores Berglas secrets. The bucket's access settings, IAM " +
+			"policy, versioning, retention policy, and default Cloud KMS key are " +
+			"checked, and each problem is returned as a finding with a severity. " +
+			"Use the findings in a `check` block to detect misconfigured buckets. " +
+			"The caller needs `storage.buckets.get` and " +
+			"`storage.buckets.getIamPolicy` on the bucket.",
+
+		ReadContext: dataSourceBerglasBucketPostureRead,
+
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket to inspect",
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			//
+			// Computed
+			//
+			"uniform_bucket_level_access": {
+				Type:        schema.TypeBool,
+				Description: "Whether uniform bucket-level access is enabled",
+				Computed:    true,
+			},
+
+			"public_access_prevention": {
+				Type:        schema.TypeString,
+				Description: "Public access prevention setting of the bucket, `enforced` or `inherited`",
+				Computed:    true,
+			},
+
+			"versioning_enabled": {
+				Type:        schema.TypeBool,
+				Description: "Whether object versioning is enabled",
+				Computed:    true,
+			},
+
+			"retention_period": {
+				Type:        schema.TypeString,
+				Description: "Retention period of the bucket's retention policy, such as `720h0m0s`, or empty if there is none",
+				Computed:    true,
+			},
+
+			"retention_locked": {
+				Type:        schema.TypeBool,
+				Description: "Whether the bucket's retention policy is locked",
+				Computed:    true,
+			},
+
+			"default_kms_key": {
+				Type:        schema.TypeString,
+				Description: "Default Cloud KMS key of the bucket, or empty if there is none",
+				Computed:    true,
+			},
+
+			"highest_severity": {
+				Type:        schema.TypeString,
+				Description: "Highest severity of the findings, or empty if there are none",
+				Computed:    true,
+			},
+
+			"findings": {
+				Type:        schema.TypeList,
+				Description: "Problems with the bucket, most severe first",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"check": {
+							Type: schema.TypeString,
+							Description: "Name of the check which failed: `uniform_bucket_level_access`, " +
+								"`public_access_prevention`, `public_member`, `broad_reader`, " +
+								"`versioning`, `retention_policy`, or `default_kms_key`",
+							Computed: true,
+						},
+
+						"severity": {
+							Type:        schema.TypeString,
+							Description: "Severity of the finding: `high`, `medium`, or `low`",
+							Computed:    true,
+						},
+
+						"message": {
+							Type:        schema.TypeString,
+							Description: "Description of the problem and how to fix it",
+							Computed:    true,
+						},
+
+						"role": {
+							Type:        schema.TypeString,
+							Description: "IAM role of the binding, for IAM findings",
+							Computed:    true,
+						},
+
+						"member": {
+							Type:        schema.TypeString,
+							Description: "IAM member of the binding, for IAM findings",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceBerglasBucketPostureRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+
+	attrs, err := backend.BucketAttrs(ctx, bucket)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to read bucket: %w", err))
+	}
+
+	policy, err := backend.BucketPolicy(ctx, bucket)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to read bucket IAM policy: %w", err))
+	}
+
+	found := bucketPostureFindings(attrs, policy)
+
+	var highest string
+	findings := make([]map[string]any, 0, len(found))
+	for _, f := range found {
+		if severityRank[f.severity] > severityRank[highest] {
+			highest = f.severity
+		}
+
+		findings = append(findings, map[string]any{
+			"check":    f.check,
+			"severity": f.severity,
+			"message":  f.message,
+			"role":     f.role,
+			"member":   f.member,
+		})
+	}
+
+	var retentionPeriod string
+	var retentionLocked bool
+	if attrs.RetentionPolicy != nil {
+		retentionPeriod = attrs.RetentionPolicy.RetentionPeriod.String()
+		retentionLocked = attrs.RetentionPolicy.IsLocked
+	}
+
+	var defaultKMSKey string
+	if attrs.Encryption != nil {
+		defaultKMSKey = attrs.Encryption.DefaultKMSKeyName
+	}
+
+	d.SetId(bucket)
+
+	if err := setMany(d, resourceFields{
+		"uniform_bucket_level_access": attrs.UniformBucketLevelAccess.Enabled,
+		"public_access_prevention":    attrs.PublicAccessPrevention.String(),
+		"versioning_enabled":          attrs.VersioningEnabled,
+		"retention_period":            retentionPeriod,
+		"retention_locked":            retentionLocked,
+		"default_kms_key":             defaultKMSKey,
+		"highest_severity":            highest,
+		"findings":                    findings,
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return nil
+}
+
+// bucketPostureFindings checks the bucket attributes and the members of each
+// role in its IAM policy against what berglas expects of a secrets bucket. The
+// findings are sorted by severity, most severe first.
+func bucketPostureFindings(attrs *storage.BucketAttrs, policy map[string][]string) []*postureFinding {
+	var findings []*postureFinding
+
+	if !attrs.UniformBucketLevelAccess.Enabled {
+		findings = append(findings, &postureFinding{
+			check:    "uniform_bucket_level_access",
+			severity: severityHigh,
+			message: "Uniform bucket-level access is disabled, so object ACLs can grant " +
+				"access to secrets outside of IAM. Enable uniform bucket-level access.",
+		})
+	}
+
+	if attrs.PublicAccessPrevention != storage.PublicAccessPreventionEnforced {
+		findings = append(findings, &postureFinding{
+			check:    "public_access_prevention",
+			severity: severityMedium,
+			message: "Public access prevention is not enforced on the bucket, so only " +
+				"the organization policy prevents granting public access. Set public " +
+				"access prevention to enforced.",
+		})
+	}
+
+	roles := make([]string, 0, len(policy))
+	for role := range policy {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+
+	for _, role := range roles {
+		members := append([]string(nil), policy[role]...)
+		sort.Strings(members)
+
+		for _, member := range members {
+			switch {
+			case publicMembers[member]:
+				findings = append(findings, &postureFinding{
+					check:    "public_member",
+					severity: severityHigh,
+					message: fmt.Sprintf("%s is granted %s on the bucket, which exposes "+
+						"secret names and ciphertext to anyone. Remove the binding.", member, role),
+					role:   role,
+					member: member,
+				})
+			case objectReaderRoles[role] && hasAnyPrefix(member, broadMemberPrefixes):
+				findings = append(findings, &postureFinding{
+					check:    "broad_reader",
+					severity: severityMedium,
+					message: fmt.Sprintf("%s is granted %s on the bucket, so every principal "+
+						"it includes can read secret ciphertext. Grant object access to "+
+						"individual service accounts instead.", member, role),
+					role:   role,
+					member: member,
+				})
+			}
+		}
+	}
+
+	if !attrs.VersioningEnabled {
+		findings = append(findings, &postureFinding{
+			check:    "versioning",
+			severity: severityLow,
+			message: "Object versioning is disabled, so overwritten secret generations " +
+				"are deleted and cannot be restored. Enable object versioning.",
+		})
+	}
+
+	if rp := attrs.RetentionPolicy; rp != nil {
+		f := &postureFinding{
+			check:    "retention_policy",
+			severity: severityMedium,
+			message: fmt.Sprintf("The bucket has a retention policy of %s, so secrets "+
+				"cannot be rotated or deleted until they are older than that. Remove "+
+				"the retention policy.", rp.RetentionPeriod),
+		}
+		if rp.IsLocked {
+			f.severity = severityHigh
+			f.message = fmt.Sprintf("The bucket has a locked retention policy of %s, "+
+				"so secrets cannot be rotated or deleted until they are older than "+
+				"that, and the policy cannot be removed. Move the secrets to another "+
+				"bucket.", rp.RetentionPeriod)
+		}
+		findings = append(findings, f)
+	}
+
+	if attrs.Encryption == nil || attrs.Encryption.DefaultKMSKeyName == "" {
+		findings = append(findings, &postureFinding{
+			check:    "default_kms_key",
+			severity: severityLow,
+			message: "The bucket has no default Cloud KMS key, so secret ciphertext is " +
+				"stored with Google-managed encryption only. Set a default Cloud KMS " +
+				"key on the bucket to also protect stored objects with a key you control.",
+		})
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityRank[findings[i].severity] > severityRank[findings[j].severity]
+	})
+	return findings
+}
+
+// hasAnyPrefix returns true if s begins with any of the prefixes.
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
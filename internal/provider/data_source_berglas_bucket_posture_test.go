@@ -0,0 +1,170 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestBucketPostureFindings(t *testing.T) {
+	t.Parallel()
+
+	secure := func() *storage.BucketAttrs {
+		return &storage.BucketAttrs{
+			UniformBucketLevelAccess: storage.UniformBucketLevelAccess{Enabled: true},
+			PublicAccessPrevention:   storage.PublicAccessPreventionEnforced,
+			VersioningEnabled:        true,
+			Encryption:               &storage.BucketEncryption{DefaultKMSKeyName: testLocalKey},
+		}
+	}
+
+	cases := []struct {
+		name   string
+		attrs  func(a *storage.BucketAttrs)
+		policy map[string][]string
+		want   []string
+	}{
+		{
+			name: "secure",
+			policy: map[string][]string{
+				"roles/storage.objectViewer":       {"serviceAccount:app@p.iam.gserviceaccount.com"},
+				"roles/storage.legacyBucketReader": {"projectViewer:p"},
+			},
+		},
+		{
+			name: "acls",
+			attrs: func(a *storage.BucketAttrs) {
+				a.UniformBucketLevelAccess.Enabled = false
+				a.PublicAccessPrevention = storage.PublicAccessPreventionInherited
+			},
+			want: []string{"high/uniform_bucket_level_access", "medium/public_access_prevention"},
+		},
+		{
+			name: "iam",
+			policy: map[string][]string{
+				"roles/storage.objectViewer":       {"allUsers", "domain:example.com"},
+				"roles/storage.legacyObjectReader": {"projectViewer:p"},
+				"roles/storage.legacyBucketReader": {"allAuthenticatedUsers"},
+			},
+			want: []string{
+				"high/public_member/roles/storage.legacyBucketReader/allAuthenticatedUsers",
+				"high/public_member/roles/storage.objectViewer/allUsers",
+				"medium/broad_reader/roles/storage.legacyObjectReader/projectViewer:p",
+				"medium/broad_reader/roles/storage.objectViewer/domain:example.com",
+			},
+		},
+		{
+			name: "storage",
+			attrs: func(a *storage.BucketAttrs) {
+				a.VersioningEnabled = false
+				a.RetentionPolicy = &storage.RetentionPolicy{RetentionPeriod: 24 * time.Hour}
+				a.Encryption = nil
+			},
+			want: []string{"medium/retention_policy", "low/versioning", "low/default_kms_key"},
+		},
+		{
+			name: "locked_retention",
+			attrs: func(a *storage.BucketAttrs) {
+				a.RetentionPolicy = &storage.RetentionPolicy{RetentionPeriod: 24 * time.Hour, IsLocked: true}
+			},
+			want: []string{"high/retention_policy"},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			attrs := secure()
+			if tc.attrs != nil {
+				tc.attrs(attrs)
+			}
+
+			var got []string
+			for _, f := range bucketPostureFindings(attrs, tc.policy) {
+				s := f.severity + "/" + f.check
+				if f.role != "" {
+					s += "/" + f.role + "/" + f.member
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q to be %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDataSourceBerglasBucketPostureRead(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, dataSourceBerglasBucketPosture().Schema, map[string]any{
+		"bucket": "my-bucket",
+	})
+
+	if diags := dataSourceBerglasBucketPostureRead(context.Background(), d, &config{backend: testLocalBackend(t)}); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	if got, want := d.Get("public_access_prevention").(string), "enforced"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := d.Get("highest_severity").(string), severityLow; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := d.Get("findings.0.check").(string), "default_kms_key"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestAccDataSourceBerglasBucketPosture_basic(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	rn := "data.berglas_bucket_posture.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testDataBerglasBucketPosture_basic(t, bucket),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "id", bucket),
+					resource.TestCheckResourceAttrSet(rn, "uniform_bucket_level_access"),
+					resource.TestCheckResourceAttrSet(rn, "public_access_prevention"),
+					resource.TestCheckResourceAttrSet(rn, "findings.#"),
+				),
+			},
+		},
+	})
+}
+
+func testDataBerglasBucketPosture_basic(t testing.TB, bucket string) string {
+	return fmt.Sprintf(`
+data "berglas_bucket_posture" "test" {
+	bucket = "%s"
+}`, bucket)
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceBerglasExpiringSecrets() *schema.Resource {
+	return &schema.Resource{
+		Description: "List Berglas secrets in a bucket which have expired or " +
+			"will expire within a window.",
+
+		ReadContext: dataSourceBerglasExpiringSecretsRead,
+
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket to list",
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"prefix": {
+				Type:        schema.TypeString,
+				Description: "Only list secrets whose name begins with this prefix",
+				Optional:    true,
+			},
+
+			"within": {
+				Type:        schema.TypeString,
+				Description: "Include secrets which expire within this duration, such as `720h`",
+				Optional:    true,
+				Default:     "168h",
+
+				ValidateDiagFunc: validateDuration,
+			},
+
+			//
+			// Computed
+			//
+			"secrets": {
+				Type:        schema.TypeList,
+				Description: "Expiring secrets, sorted by expiration time",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Description: "Import ID for the `berglas_secret` resource",
+							Computed:    true,
+						},
+
+						"name": {
+							Type:        schema.TypeString,
+							Description: "Name of the secret object in the bucket",
+							Computed:    true,
+						},
+
+						"expires_at": {
+							Type:        schema.TypeString,
+							Description: "RFC 3339 timestamp when the secret expires",
+							Computed:    true,
+						},
+
+						"expired": {
+							Type:        schema.TypeBool,
+							Description: "Whether the secret has already expired",
+							Computed:    true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceBerglasExpiringSecretsRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+	prefix := d.Get("prefix").(string)
+
+	within, err := time.ParseDuration(d.Get("within").(string))
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to parse within: %w", err))
+	}
+
+	now := time.Now()
+	cutoff := now.Add(within)
+
+	type expiring struct {
+		name      string
+		expiresAt time.Time
+		id        string
+	}
+	var found []*expiring
+
+	objs, err := backend.List(ctx, bucket, prefix)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to list secrets: %w", err))
+	}
+
+	var diags diag.Diagnostics
+	for _, obj := range objs {
+		// Skip anything that was not written by berglas or does not expire
+		if obj.Metadata[berglas.MetadataIDKey] != "1" || obj.Metadata[metadataExpiresAt] == "" {
+			continue
+		}
+
+		// One invalid expiration should not hide the other secrets
+		expiresAt, err := time.Parse(time.RFC3339, obj.Metadata[metadataExpiresAt])
+		if err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Invalid secret expiration",
+				Detail: fmt.Sprintf("Secret %q was skipped because it has an invalid "+
+					"expiration time %q in its metadata: %s", obj.Name,
+					obj.Metadata[metadataExpiresAt], err),
+			})
+			continue
+		}
+
+		if expiresAt.After(cutoff) {
+			continue
+		}
+
+		found = append(found, &expiring{
+			name:      obj.Name,
+			expiresAt: expiresAt,
+			id:        encodeId(bucket, obj.Name, 0),
+		})
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].expiresAt.Equal(found[j].expiresAt) {
+			return found[i].name < found[j].name
+		}
+		return found[i].expiresAt.Before(found[j].expiresAt)
+	})
+
+	secrets := make([]map[string]any, 0, len(found))
+	for _, f := range found {
+		secrets = append(secrets, map[string]any{
+			"id":         f.id,
+			"name":       f.name,
+			"expires_at": f.expiresAt.UTC().Format(time.RFC3339),
+			"expired":    !now.Before(f.expiresAt),
+		})
+	}
+
+	d.SetId(bucket + "/" + prefix)
+
+	if err := d.Set("secrets", secrets); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to set secrets: %w", err))
+	}
+
+	return diags
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestDataSourceBerglasExpiringSecretsRead_invalid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	for name, expiresAt := range map[string]string{
+		"invalid": "tomorrow",
+		"valid":   time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	} {
+		attrs, err := backend.Create(ctx, "my-bucket", name, testLocalKey, []byte("value"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := backend.PatchMetadata(ctx, "my-bucket", name, attrs.Generation, attrs.Metageneration,
+			map[string]string{metadataExpiresAt: expiresAt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := schema.TestResourceDataRaw(t, dataSourceBerglasExpiringSecrets().Schema, map[string]any{
+		"bucket": "my-bucket",
+	})
+
+	diags := dataSourceBerglasExpiringSecretsRead(ctx, d, &config{backend: backend})
+	if diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Errorf("expected 1 warning, got %#v", diags)
+	}
+
+	if got, want := d.Get("secrets.#").(int), 1; got != want {
+		t.Fatalf("expected %d secrets to be %d", got, want)
+	}
+	if got, want := d.Get("secrets.0.name").(string), "valid"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
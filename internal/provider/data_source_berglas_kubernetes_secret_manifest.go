@@ -0,0 +1,346 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	kubernetesSecretTypeOpaque           = "Opaque"
+	kubernetesSecretTypeDockerConfigJSON = "kubernetes.io/dockerconfigjson"
+	kubernetesSecretTypeTLS              = "kubernetes.io/tls"
+)
+
+var (
+	// kubernetesNameRegexp matches a Kubernetes DNS subdomain name, which is
+	// required for Secret names and namespaces.
+	kubernetesNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]{0,251}[a-z0-9])?$`)
+
+	// kubernetesSecretKeyRegexp matches valid keys in the data of a Secret.
+	kubernetesSecretKeyRegexp = regexp.MustCompile(`^[-._a-zA-Z0-9]{1,253}$`)
+)
+
+// kubernetesSecretRequiredKeys are the keys which must be present for each
+// built-in Secret type.
+var kubernetesSecretRequiredKeys = map[string][]string{
+	kubernetesSecretTypeDockerConfigJSON: {".dockerconfigjson"},
+	kubernetesSecretTypeTLS:              {"tls.crt", "tls.key"},
+}
+
+// kubernetesSecret is a Kubernetes Secret manifest. The fields are ordered as
+// kubectl renders them.
+type kubernetesSecret struct {
+	APIVersion string                   `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string                   `json:"kind" yaml:"kind"`
+	Metadata   kubernetesSecretMetadata `json:"metadata" yaml:"metadata"`
+	Type       string                   `json:"type" yaml:"type"`
+	Data       map[string]string        `json:"data" yaml:"data"`
+}
+
+type kubernetesSecretMetadata struct {
+	Name        string            `json:"name" yaml:"name"`
+	Namespace   string            `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+}
+
+func dataSourceBerglasKubernetesSecretManifest() *schema.Resource {
+	return &schema.Resource{
+		Description: "Render a Kubernetes Secret manifest from Berglas secrets. " +
+			"Each key in `secrets` is resolved in parallel and base64-encoded into " +
+			"the `data` of the manifest.",
+
+		ReadContext: dataSourceBerglasKubernetesSecretManifestRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:        schema.TypeString,
+				Description: "Name of the Kubernetes Secret",
+				Required:    true,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(
+					kubernetesNameRegexp, "must be a lowercase DNS subdomain")),
+			},
+
+			"namespace": {
+				Type:        schema.TypeString,
+				Description: "Namespace of the Kubernetes Secret. Omitted from the manifest if unset.",
+				Optional:    true,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(
+					kubernetesNameRegexp, "must be a lowercase DNS subdomain")),
+			},
+
+			"type": {
+				Type: schema.TypeString,
+				Description: "Type of the Kubernetes Secret, such as `Opaque`, " +
+					"`kubernetes.io/dockerconfigjson`, or `kubernetes.io/tls`. The " +
+					"required keys of the built-in types are validated.",
+				Optional: true,
+				Default:  kubernetesSecretTypeOpaque,
+			},
+
+			"secrets": {
+				Type: schema.TypeMap,
+				Description: "Map of Secret data key to the Berglas secret to store " +
+					"there. Values are in the format `{bucket}/{name}`, " +
+					"`berglas://{bucket}/{name}`, or `sm://{project}/{name}`, with an " +
+					"optional `#{generation}` or `#{version}`.",
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"labels": {
+				Type:        schema.TypeMap,
+				Description: "Labels of the Kubernetes Secret",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"annotations": {
+				Type:        schema.TypeMap,
+				Description: "Annotations of the Kubernetes Secret",
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"parallelism": {
+				Type:        schema.TypeInt,
+				Description: "Maximum number of secrets to resolve concurrently",
+				Optional:    true,
+				Default:     8,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(1, 256)),
+			},
+
+			//
+			// Computed
+			//
+			"data": {
+				Type:        schema.TypeMap,
+				Description: "Base64-encoded `data` of the Kubernetes Secret",
+				Computed:    true,
+				Sensitive:   true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"manifest_yaml": {
+				Type:        schema.TypeString,
+				Description: "Kubernetes Secret manifest as YAML",
+				Computed:    true,
+				Sensitive:   true,
+			},
+
+			"manifest_json": {
+				Type:        schema.TypeString,
+				Description: "Kubernetes Secret manifest as JSON",
+				Computed:    true,
+				Sensitive:   true,
+			},
+		},
+	}
+}
+
+func dataSourceBerglasKubernetesSecretManifestRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+
+	name := d.Get("name").(string)
+	namespace := d.Get("namespace").(string)
+	typ := d.Get("type").(string)
+	refs := d.Get("secrets").(map[string]any)
+
+	keys := make([]string, 0, len(refs))
+	for k := range refs {
+		if !kubernetesSecretKeyRegexp.MatchString(k) {
+			return diag.Errorf("secrets: %q is not a valid Secret key", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range kubernetesSecretRequiredKeys[typ] {
+		if _, ok := refs[k]; !ok {
+			return diag.Errorf("secrets: %q is required for Secrets of type %q", k, typ)
+		}
+	}
+
+	var lock sync.Mutex
+	plaintexts := make(map[string][]byte, len(refs))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(d.Get("parallelism").(int))
+
+	for _, k := range keys {
+		k := k
+		ref := refs[k].(string)
+
+		g.Go(func() error {
+			plaintext, err := resolveSecretRef(gctx, config, ref)
+			if err != nil {
+				return fmt.Errorf("secrets: failed to resolve %q: %w", k, err)
+			}
+
+			lock.Lock()
+			plaintexts[k] = plaintext
+			lock.Unlock()
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := validateKubernetesSecretData(typ, plaintexts); err != nil {
+		return diag.FromErr(err)
+	}
+
+	data := make(map[string]string, len(plaintexts))
+	for k, v := range plaintexts {
+		data[k] = base64.StdEncoding.EncodeToString(v)
+	}
+
+	manifest := &kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: kubernetesSecretMetadata{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      expandStringMap(d.Get("labels").(map[string]any)),
+			Annotations: expandStringMap(d.Get("annotations").(map[string]any)),
+		},
+		Type: typ,
+		Data: data,
+	}
+
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to render YAML: %w", err))
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to render JSON: %w", err))
+	}
+
+	d.SetId(namespace + "/" + name)
+
+	if err := setMany(d, resourceFields{
+		"data":          data,
+		"manifest_yaml": string(manifestYAML),
+		"manifest_json": string(manifestJSON),
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return nil
+}
+
+// validateKubernetesSecretData validates the contents of the keys required by
+// the built-in Secret types. Errors do not include the plaintext.
+func validateKubernetesSecretData(typ string, data map[string][]byte) error {
+	switch typ {
+	case kubernetesSecretTypeDockerConfigJSON:
+		var cfg struct {
+			Auths map[string]json.RawMessage `json:"auths"`
+		}
+		if err := json.Unmarshal(data[".dockerconfigjson"], &cfg); err != nil || cfg.Auths == nil {
+			return fmt.Errorf("secrets: .dockerconfigjson must be a JSON object with \"auths\"")
+		}
+	case kubernetesSecretTypeTLS:
+		for _, k := range []string{"tls.crt", "tls.key"} {
+			if block, _ := pem.Decode(data[k]); block == nil {
+				return fmt.Errorf("secrets: %s must be PEM-encoded", k)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSecretRef reads the plaintext of a secret reference. The reference is
+// a Berglas reference (berglas:// or sm://) or a {bucket}/{object}[#generation]
+// ID.
+func resolveSecretRef(ctx context.Context, config *config, ref string) ([]byte, error) {
+	if !berglas.IsReference(ref) {
+		bucket, object, generation, err := decodeId(ref)
+		if err != nil {
+			return nil, err
+		}
+
+		backend, err := config.Backend(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return backend.Access(ctx, bucket, object, generation)
+	}
+
+	r, err := berglas.ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Type() == berglas.ReferenceTypeStorage {
+		backend, err := config.Backend(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return backend.Access(ctx, r.Bucket(), r.Object(), r.Generation())
+	}
+
+	client, err := config.Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	secret, err := client.Read(ctx, &berglas.SecretManagerReadRequest{
+		Project: r.Project(),
+		Name:    r.Name(),
+		Version: r.Version(),
+	})
+	logCall(ctx, "sm_access", start, err, map[string]any{
+		"project": r.Project(),
+		"name":    r.Name(),
+		"version": r.Version(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return secret.Plaintext, nil
+}
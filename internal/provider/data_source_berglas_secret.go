@@ -16,36 +16,89 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
 
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func dataSourceBerglasSecret() *schema.Resource {
 	return &schema.Resource{
-		Description: "Access Berglas secrets.",
+		Description: "Access Berglas secrets stored in Cloud Storage or Secret Manager.",
 
 		ReadContext: dataSourceBerglasSecretRead,
 
 		Schema: map[string]*schema.Schema{
 			"bucket": {
+				Type:         schema.TypeString,
+				Description:  "Name of the Cloud Storage bucket for the secret",
+				ForceNew:     true,
+				Optional:     true,
+				ExactlyOneOf: []string{"bucket", "project"},
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"project": {
 				Type:        schema.TypeString,
-				Description: "Name of the Cloud Storage bucket for the secret",
+				Description: "ID of the Google Cloud project for a Secret Manager secret",
 				ForceNew:    true,
-				Required:    true,
+				Optional:    true,
 			},
 
 			"name": {
 				Type:        schema.TypeString,
-				Description: "Name of the secret object in the bucket",
+				Description: "Name of the secret object in the bucket, or of the Secret Manager secret",
 				ForceNew:    true,
 				Required:    true,
 			},
 
 			"generation": {
-				Type:        schema.TypeInt,
-				Description: "Generation of the object",
+				Type:          schema.TypeInt,
+				Description:   "Generation of the object",
+				Optional:      true,
+				ConflictsWith: []string{"project"},
+			},
+
+			"version": {
+				Type:          schema.TypeString,
+				Description:   "Version of the Secret Manager secret, defaults to the latest version",
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"bucket"},
+			},
+
+			"format": {
+				Type: schema.TypeString,
+				Description: "Format of the plaintext to parse into `values`, one of " +
+					"`raw`, `json`, `yaml`, `dotenv`, or `properties`. With `raw`, the " +
+					"plaintext is not parsed.",
+				Optional: true,
+				Default:  formatRaw,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{
+					formatRaw,
+					formatJSON,
+					formatYAML,
+					formatDotenv,
+					formatProperties,
+				}, false)),
+			},
+
+			"expiry_warning_period": {
+				Type:        schema.TypeString,
+				Description: "How long before `expires_at` to start warning on read",
 				Optional:    true,
+				Default:     "168h",
+
+				ValidateDiagFunc: validateDuration,
 			},
 
 			//
@@ -65,21 +118,236 @@ func dataSourceBerglasSecret() *schema.Resource {
 				Sensitive:   true,
 			},
 
+			"json": {
+				Type: schema.TypeMap,
+				Description: "Fields of the plaintext if it is a JSON object. String " +
+					"values are unquoted and other values are JSON-encoded. Empty if the " +
+					"plaintext is not a JSON object.",
+				Computed:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"values": {
+				Type: schema.TypeMap,
+				Description: "Values parsed from the plaintext according to `format`. " +
+					"Nested YAML and JSON values are JSON-encoded.",
+				Computed:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
 			"metageneration": {
 				Type:        schema.TypeInt,
 				Description: "Metageneration of the object",
 				Computed:    true,
 			},
+
+			"created_at": {
+				Type:        schema.TypeString,
+				Description: "RFC 3339 timestamp when the object or secret version was created",
+				Computed:    true,
+			},
+
+			"updated_at": {
+				Type:        schema.TypeString,
+				Description: "RFC 3339 timestamp when the object metadata was last updated",
+				Computed:    true,
+			},
+
+			"size": {
+				Type:        schema.TypeInt,
+				Description: "Size of the encrypted object in bytes",
+				Computed:    true,
+			},
+
+			"crc32c": {
+				Type:        schema.TypeString,
+				Description: "Base64-encoded CRC32C checksum of the encrypted object",
+				Computed:    true,
+			},
+
+			"md5": {
+				Type:        schema.TypeString,
+				Description: "Base64-encoded MD5 hash of the encrypted object",
+				Computed:    true,
+			},
+
+			"storage_class": {
+				Type:        schema.TypeString,
+				Description: "Storage class of the object",
+				Computed:    true,
+			},
+
+			"kms_key_version": {
+				Type: schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key version which " +
+					"encrypted the secret, if it was recorded when the secret was written",
+				Computed: true,
+			},
+
+			"kms_key_version_state": {
+				Type: schema.TypeString,
+				Description: "State of the Cloud KMS key version, such as `ENABLED` or " +
+					"`DESTROY_SCHEDULED`. Empty if the key version is unknown or the " +
+					"caller cannot view it.",
+				Computed: true,
+			},
+
+			"labels": {
+				Type:        schema.TypeMap,
+				Description: "Custom object metadata",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"expires_at": {
+				Type:        schema.TypeString,
+				Description: "RFC 3339 timestamp when the secret expires, if set",
+				Computed:    true,
+			},
+
+			"version_state": {
+				Type:        schema.TypeString,
+				Description: "State of the Secret Manager secret version",
+				Computed:    true,
+			},
 		},
 	}
 }
 
 func dataSourceBerglasSecretRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	if _, ok := d.GetOk("project"); ok {
+		return dataSourceBerglasSecretReadSecretManager(ctx, d, meta)
+	}
+
 	bucket := d.Get("bucket").(string)
 	name := d.Get("name").(string)
 	generation := d.Get("generation").(int)
 
 	id := encodeId(bucket, name, int64(generation))
 	d.SetId(id)
-	return resourceBerglasSecretRead(ctx, d, meta)
+
+	attrs, diags := readBerglasSecret(ctx, d, meta, false)
+	if diags.HasError() {
+		return diags
+	}
+
+	diags = append(diags, readBerglasSecretExpiry(d, attrs, diag.Error)...)
+	if diags.HasError() {
+		return diags
+	}
+
+	crc32c := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc32c, attrs.CRC32C)
+
+	if err := setMany(d, resourceFields{
+		"created_at":    attrs.Created.UTC().Format(time.RFC3339),
+		"updated_at":    attrs.Updated.UTC().Format(time.RFC3339),
+		"size":          attrs.Size,
+		"crc32c":        base64.StdEncoding.EncodeToString(crc32c),
+		"md5":           base64.StdEncoding.EncodeToString(attrs.MD5),
+		"storage_class": attrs.StorageClass,
+		"labels":        customMetadata(attrs.Metadata),
+		"json":          dataSourceBerglasSecretJSON(d.Get("plaintext").(string)),
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return append(diags, dataSourceBerglasSecretValues(d)...)
+}
+
+// dataSourceBerglasSecretReadSecretManager reads a secret from Secret Manager.
+func dataSourceBerglasSecretReadSecretManager(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	client, err := config.Client(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	smClient, err := config.SecretManagerClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	project := d.Get("project").(string)
+	name := d.Get("name").(string)
+	version := d.Get("version").(string)
+
+	start := time.Now()
+	secret, err := client.Read(ctx, &berglas.SecretManagerReadRequest{
+		Project: project,
+		Name:    name,
+		Version: version,
+	})
+	logCall(ctx, "sm_access", start, err, map[string]any{
+		"project": project,
+		"name":    name,
+		"version": version,
+	})
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to read secret: %w", err))
+	}
+
+	versionName := fmt.Sprintf("projects/%s/secrets/%s/versions/%s", project, name, secret.Version)
+	start = time.Now()
+	resp, err := smClient.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+		Name: versionName,
+	})
+	logCall(ctx, "sm_get_secret_version", start, err, map[string]any{
+		"name": versionName,
+	})
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to read secret version: %w", err))
+	}
+
+	d.SetId(fmt.Sprintf("sm://%s/%s#%s", project, name, secret.Version))
+
+	if err := setMany(d, resourceFields{
+		"version":       secret.Version,
+		"plaintext":     string(secret.Plaintext),
+		"json":          dataSourceBerglasSecretJSON(string(secret.Plaintext)),
+		"created_at":    resp.GetCreateTime().AsTime().UTC().Format(time.RFC3339),
+		"version_state": resp.GetState().String(),
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return dataSourceBerglasSecretValues(d)
+}
+
+// dataSourceBerglasSecretJSON returns the fields of the plaintext, or nil if it
+// is not a JSON object.
+func dataSourceBerglasSecretJSON(plaintext string) map[string]string {
+	m, err := flattenJSON(plaintext)
+	if err != nil {
+		return nil
+	}
+	return m
+}
+
+// dataSourceBerglasSecretValues parses the plaintext into values according to
+// the format. Parse errors identify the line, but not the plaintext.
+func dataSourceBerglasSecretValues(d *schema.ResourceData) diag.Diagnostics {
+	format := d.Get("format").(string)
+
+	values, err := parsePayload(format, d.Get("plaintext").(string))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Failed to parse secret",
+			Detail:        fmt.Sprintf("%q is not valid %s: %s", d.Get("name").(string), format, err),
+			AttributePath: cty.GetAttrPath("format"),
+		}}
+	}
+
+	if err := d.Set("values", values); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to set values: %w", err))
+	}
+	return nil
 }
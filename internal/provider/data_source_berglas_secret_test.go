@@ -17,6 +17,7 @@ package provider
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
@@ -67,11 +68,68 @@ func TestAccDataSourceBerglasSecret_basic(t *testing.T) {
 					resource.TestCheckResourceAttrSet(rn, "bucket"),
 					resource.TestCheckResourceAttrSet(rn, "name"),
 					resource.TestCheckResourceAttrSet(rn, "plaintext"),
+					resource.TestCheckResourceAttrSet(rn, "created_at"),
+					resource.TestCheckResourceAttrSet(rn, "updated_at"),
+					resource.TestCheckResourceAttrSet(rn, "size"),
+					resource.TestCheckResourceAttrSet(rn, "crc32c"),
+					resource.TestCheckResourceAttrSet(rn, "md5"),
+					resource.TestCheckResourceAttrSet(rn, "storage_class"),
 				),
 			},
 		},
 	})
 }
+
+func TestAccDataSourceBerglasSecret_format(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+	ctx := context.Background()
+
+	// Create a dotenv secret for reading
+	if _, err := berglas.Create(ctx, &berglas.CreateRequest{
+		Bucket:    bucket,
+		Object:    name,
+		Plaintext: []byte("DB_USER=app\nDB_PASSWORD='testing123'\n"),
+		Key:       key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleanup the secret
+	defer func() {
+		if err := berglas.Delete(ctx, &berglas.DeleteRequest{
+			Bucket: bucket,
+			Object: name,
+		}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	rn := "data.berglas_secret.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testDataBerglasSecret_format(t, bucket, name, formatDotenv),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "values.%", "2"),
+					resource.TestCheckResourceAttr(rn, "values.DB_USER", "app"),
+					resource.TestCheckResourceAttr(rn, "values.DB_PASSWORD", "testing123"),
+				),
+			},
+			{
+				Config:      testDataBerglasSecret_format(t, bucket, name, formatJSON),
+				ExpectError: regexp.MustCompile(`line 1: invalid JSON`),
+			},
+		},
+	})
+}
+
 func testDataBerglasSecret_basic(t testing.TB, bucket, name string, generation int64) string {
 	return fmt.Sprintf(`
 data "berglas_secret" "test" {
@@ -80,3 +138,12 @@ data "berglas_secret" "test" {
 	generation = "%d"
 }`, bucket, name, generation)
 }
+
+func testDataBerglasSecret_format(t testing.TB, bucket, name, format string) string {
+	return fmt.Sprintf(`
+data "berglas_secret" "test" {
+	bucket = "%s"
+	name   = "%s"
+	format = "%s"
+}`, bucket, name, format)
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceBerglasSecrets() *schema.Resource {
+	return &schema.Resource{
+		Description: "List Berglas secrets in a bucket. Each entry includes an " +
+			"`id` which can be passed directly to an `import` block for " +
+			"`berglas_secret`.",
+
+		ReadContext: dataSourceBerglasSecretsRead,
+
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket to list",
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"prefix": {
+				Type:        schema.TypeString,
+				Description: "Only list secrets whose name begins with this prefix",
+				Optional:    true,
+			},
+
+			"labels": {
+				Type: schema.TypeMap,
+				Description: "Only list secrets whose custom object metadata " +
+					"contains all of these key/value pairs",
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			//
+			// Computed
+			//
+			"secrets": {
+				Type:        schema.TypeList,
+				Description: "Secrets that matched the filters, sorted by name",
+				Computed:    true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:        schema.TypeString,
+							Description: "Import ID for the `berglas_secret` resource in the format `{bucket}/{name}`",
+							Computed:    true,
+						},
+
+						"name": {
+							Type:        schema.TypeString,
+							Description: "Name of the secret object in the bucket",
+							Computed:    true,
+						},
+
+						"key": {
+							Type:        schema.TypeString,
+							Description: "Fully-qualified name of the Cloud KMS key",
+							Computed:    true,
+						},
+
+						"generation": {
+							Type:        schema.TypeInt,
+							Description: "Live generation of the object",
+							Computed:    true,
+						},
+
+						"metageneration": {
+							Type:        schema.TypeInt,
+							Description: "Metageneration of the object",
+							Computed:    true,
+						},
+
+						"labels": {
+							Type:        schema.TypeMap,
+							Description: "Custom object metadata",
+							Computed:    true,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceBerglasSecretsRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+	prefix := d.Get("prefix").(string)
+
+	labels := make(map[string]string)
+	for k, v := range d.Get("labels").(map[string]any) {
+		labels[k] = v.(string)
+	}
+
+	secrets := make([]map[string]any, 0, 8)
+
+	objs, err := backend.List(ctx, bucket, prefix)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to list secrets: %w", err))
+	}
+
+	for _, obj := range objs {
+		// Skip anything that was not written by berglas
+		if obj.Metadata[berglas.MetadataIDKey] != "1" {
+			continue
+		}
+
+		objLabels := customMetadata(obj.Metadata)
+		if !hasLabels(objLabels, labels) {
+			continue
+		}
+
+		secrets = append(secrets, map[string]any{
+			"id":             encodeId(bucket, obj.Name, 0),
+			"name":           obj.Name,
+			"key":            obj.Metadata[berglas.MetadataKMSKey],
+			"generation":     obj.Generation,
+			"metageneration": obj.Metageneration,
+			"labels":         objLabels,
+		})
+	}
+
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i]["name"].(string) < secrets[j]["name"].(string)
+	})
+
+	d.SetId(bucket + "/" + prefix)
+
+	if err := d.Set("secrets", secrets); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to set secrets: %w", err))
+	}
+
+	return nil
+}
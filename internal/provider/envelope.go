@@ -0,0 +1,131 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+)
+
+// errObjectModified is returned when a precondition fails because the object
+// was modified concurrently.
+var errObjectModified = errors.New("object was modified concurrently")
+
+// errObjectExists is returned when creating an object which already exists.
+var errObjectExists = errors.New("object already exists")
+
+// splitCiphertext splits a berglas storage object into the KMS-encrypted data
+// encryption key and the ciphertext. Objects are in the format:
+//
+//	b64(kms_encrypted_dek):b64(dek_encrypted_plaintext)
+func splitCiphertext(data []byte) ([]byte, []byte, error) {
+	parts := strings.SplitN(string(data), ":", 2)
+	if len(parts) < 2 {
+		return nil, nil, fmt.Errorf("invalid ciphertext: not enough parts")
+	}
+
+	encDEK, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ciphertext: failed to parse dek")
+	}
+
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid ciphertext: failed to parse ciphertext")
+	}
+
+	return encDEK, ciphertext, nil
+}
+
+// joinCiphertext is the inverse of splitCiphertext.
+func joinCiphertext(encDEK, ciphertext []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(encDEK) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext))
+}
+
+// trimKMSKeyVersion removes the version from a Cloud KMS key version name,
+// returning the key name.
+func trimKMSKeyVersion(s string) string {
+	if i := strings.Index(s, "/cryptoKeyVersions/"); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// rewrapMetadata returns a copy of the object metadata which records that the
+// data encryption key is now encrypted with keyVersion of key.
+func rewrapMetadata(m map[string]string, key, keyVersion string) map[string]string {
+	metadata := make(map[string]string, len(m)+2)
+	for k, v := range m {
+		metadata[k] = v
+	}
+	metadata[berglas.MetadataKMSKey] = trimKMSKeyVersion(key)
+	metadata[metadataKMSKeyVersion] = keyVersion
+	return metadata
+}
+
+// envelopeEncrypt encrypts the plaintext with AES-256-GCM using the given key,
+// prepending the random nonce to the ciphertext. This matches the format
+// berglas uses for the secret data.
+func envelopeEncrypt(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return aesgcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// envelopeDecrypt is the inverse of envelopeEncrypt.
+func envelopeDecrypt(key, data, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+
+	size := aesgcm.NonceSize()
+	if len(data) < size {
+		return nil, fmt.Errorf("invalid ciphertext: too short")
+	}
+
+	plaintext, err := aesgcm.Open(nil, data[:size], data[size:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCiphertext(t *testing.T) {
+	t.Parallel()
+
+	encDEK, ciphertext := []byte("dek"), []byte("ciphertext")
+	gotDEK, gotCiphertext, err := splitCiphertext(joinCiphertext(encDEK, ciphertext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotDEK, encDEK) {
+		t.Errorf("expected dek %q to be %q", gotDEK, encDEK)
+	}
+	if !bytes.Equal(gotCiphertext, ciphertext) {
+		t.Errorf("expected ciphertext %q to be %q", gotCiphertext, ciphertext)
+	}
+
+	for _, data := range []string{"", "nope", "!!:ZGVr", "ZGVr:!!"} {
+		if _, _, err := splitCiphertext([]byte(data)); err == nil {
+			t.Errorf("expected error for %q", data)
+		}
+	}
+}
+
+func TestTrimKMSKeyVersion(t *testing.T) {
+	t.Parallel()
+
+	key := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	if got := trimKMSKeyVersion(key + "/cryptoKeyVersions/3"); got != key {
+		t.Errorf("expected %q to be %q", got, key)
+	}
+	if got := trimKMSKeyVersion(key); got != key {
+		t.Errorf("expected %q to be %q", got, key)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// isNotFound returns true if the error means the secret, or the Cloud KMS key
+// which encrypts it, does not exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, storage.ErrObjectNotExist) ||
+		berglas.IsSecretDoesNotExistErr(err) ||
+		httpStatusCode(err) == http.StatusNotFound ||
+		grpcCode(err) == codes.NotFound
+}
+
+// isPermissionDenied returns true if the error means the caller does not have
+// permission on the bucket or the Cloud KMS key.
+func isPermissionDenied(err error) bool {
+	return httpStatusCode(err) == http.StatusForbidden ||
+		grpcCode(err) == codes.PermissionDenied
+}
+
+// isPreconditionFailed returns true if the error means the secret was modified
+// since it was last read.
+func isPreconditionFailed(err error) bool {
+	return errors.Is(err, errObjectModified) ||
+		berglas.IsSecretModifiedErr(err) ||
+		httpStatusCode(err) == http.StatusPreconditionFailed
+}
+
+// apiErrorDiagnostics converts an error from the backend into a diagnostic.
+// Permission, not found, and precondition errors explain how to resolve them
+// and point at the attribute to fix. Errors from Cloud KMS, which are gRPC
+// errors, point at key, and errors from Cloud Storage point at the secret.
+func apiErrorDiagnostics(action string, err error) diag.Diagnostics {
+	d := diag.Diagnostic{
+		Severity: diag.Error,
+		Summary:  fmt.Sprintf("Failed to %s", action),
+		Detail:   err.Error(),
+	}
+	kms := grpcCode(err) != codes.OK
+
+	switch {
+	case isPermissionDenied(err) && kms:
+		d.Summary = "Permission denied on the Cloud KMS key"
+		d.Detail = fmt.Sprintf("Failed to %s: %s. The caller needs %s on the key.",
+			action, err, strings.Join(keyPermissions, ", "))
+		d.AttributePath = cty.GetAttrPath("key")
+	case isPermissionDenied(err):
+		d.Summary = "Permission denied on the bucket"
+		d.Detail = fmt.Sprintf("Failed to %s: %s. The caller needs %s on the bucket.",
+			action, err, strings.Join(bucketPermissions, ", "))
+		d.AttributePath = cty.GetAttrPath("bucket")
+	case isNotFound(err) && kms:
+		d.Summary = "Cloud KMS key not found"
+		d.Detail = fmt.Sprintf("Failed to %s: %s. Check that the key exists and "+
+			"that key is the fully-qualified key name.", action, err)
+		d.AttributePath = cty.GetAttrPath("key")
+	case isNotFound(err):
+		d.Summary = "Secret not found"
+		d.Detail = fmt.Sprintf("Failed to %s: %s. Check that the bucket and name "+
+			"are correct and that the generation was not deleted.", action, err)
+		d.AttributePath = cty.GetAttrPath("name")
+	case errors.Is(err, errObjectExists):
+		d.Summary = "Secret already exists"
+		d.Detail = fmt.Sprintf("Failed to %s: the secret already exists. Import "+
+			"it with terraform import, or set on_conflict to %q or %q to take it "+
+			"over.", action, onConflictAdopt, onConflictOverwrite)
+		d.AttributePath = cty.GetAttrPath("on_conflict")
+	case isPreconditionFailed(err):
+		d.Summary = "Secret was modified concurrently"
+		d.Detail = fmt.Sprintf("Failed to %s: the secret was modified outside of "+
+			"Terraform since it was last read. Run terraform plan again, which "+
+			"refreshes the secret to its live generation, and review the changes "+
+			"before applying.", action)
+		d.AttributePath = cty.GetAttrPath("generation")
+	}
+	return diag.Diagnostics{d}
+}
+
+// missingPermissionsError returns the error for a plan-time permission check
+// which found the caller is missing permissions on the bucket or key named by
+// attr. CustomizeDiff can only return an error, so the message follows the
+// summary and detail of the apply-time diagnostic from apiErrorDiagnostics.
+func missingPermissionsError(attr, value string, missing []string) error {
+	resource, needed := "bucket", bucketPermissions
+	if attr == "key" {
+		resource, needed = "Cloud KMS key", keyPermissions
+	}
+
+	return fmt.Errorf("Permission denied on the %s: the caller is missing %s "+
+		"on %s = %q. The caller needs %s on the %s.", resource,
+		strings.Join(missing, ", "), attr, value, strings.Join(needed, ", "), attr)
+}
+
+// httpStatusCode returns the HTTP status code of a Cloud Storage error, or 0.
+func httpStatusCode(err error) int {
+	var terr *googleapi.Error
+	if errors.As(err, &terr) {
+		return terr.Code
+	}
+	return 0
+}
+
+// grpcCode returns the code of a gRPC error, such as those from Cloud KMS, or
+// codes.OK if the error is not a gRPC error. Unlike status.Code, it unwraps
+// the error.
+func grpcCode(err error) codes.Code {
+	var terr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &terr) {
+		return terr.GRPCStatus().Code()
+	}
+	return codes.OK
+}
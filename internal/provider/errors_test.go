@@ -0,0 +1,156 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/go-cty/cty"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIErrorDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name     string
+		err      error
+		summary  string
+		attr     string
+		notFound bool
+	}{
+		{
+			name:    "storage_forbidden",
+			err:     fmt.Errorf("failed to read: %w", &googleapi.Error{Code: 403}),
+			summary: "Permission denied on the bucket",
+			attr:    "bucket",
+		},
+		{
+			name:     "storage_not_found",
+			err:      fmt.Errorf("failed to read: %w", storage.ErrObjectNotExist),
+			summary:  "Secret not found",
+			attr:     "name",
+			notFound: true,
+		},
+		{
+			name:    "storage_precondition",
+			err:     &googleapi.Error{Code: 412},
+			summary: "Secret was modified concurrently",
+			attr:    "generation",
+		},
+		{
+			name:    "modified",
+			err:     fmt.Errorf("failed to update: %w", errObjectModified),
+			summary: "Secret was modified concurrently",
+			attr:    "generation",
+		},
+		{
+			name:    "kms_forbidden",
+			err:     fmt.Errorf("failed to decrypt dek: %w", status.Error(codes.PermissionDenied, "denied")),
+			summary: "Permission denied on the Cloud KMS key",
+			attr:    "key",
+		},
+		{
+			name:     "kms_not_found",
+			err:      fmt.Errorf("failed to get key: %w", status.Error(codes.NotFound, "not found")),
+			summary:  "Cloud KMS key not found",
+			attr:     "key",
+			notFound: true,
+		},
+		{
+			name:    "other",
+			err:     fmt.Errorf("boom"),
+			summary: "Failed to read secret",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := isNotFound(tc.err); got != tc.notFound {
+				t.Errorf("expected isNotFound to be %t", tc.notFound)
+			}
+
+			diags := apiErrorDiagnostics("read secret", tc.err)
+			if got, want := len(diags), 1; got != want {
+				t.Fatalf("expected %d diagnostics to be %d", got, want)
+			}
+			if got, want := diags[0].Summary, tc.summary; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+
+			var want cty.Path
+			if tc.attr != "" {
+				want = cty.GetAttrPath(tc.attr)
+			}
+			if got := diags[0].AttributePath; !got.Equals(want) {
+				t.Errorf("expected %#v to be %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestMissingPermissionsError(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		attr    string
+		value   string
+		missing []string
+		exp     string
+	}{
+		{
+			name:    "bucket",
+			attr:    "bucket",
+			value:   "my-bucket",
+			missing: []string{"storage.objects.create"},
+			exp: `Permission denied on the bucket: the caller is missing ` +
+				`storage.objects.create on bucket = "my-bucket". The caller needs ` +
+				`storage.objects.create, storage.objects.delete, storage.objects.get ` +
+				`on the bucket.`,
+		},
+		{
+			name:    "key",
+			attr:    "key",
+			value:   "projects/p/locations/l/keyRings/r/cryptoKeys/k",
+			missing: []string{"cloudkms.cryptoKeyVersions.useToEncrypt"},
+			exp: `Permission denied on the Cloud KMS key: the caller is missing ` +
+				`cloudkms.cryptoKeyVersions.useToEncrypt on key = "projects/p/locations/l/keyRings/r/cryptoKeys/k". ` +
+				`The caller needs cloudkms.cryptoKeyVersions.useToDecrypt, ` +
+				`cloudkms.cryptoKeyVersions.useToEncrypt on the key.`,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := missingPermissionsError(tc.attr, tc.value, tc.missing)
+			if got := err.Error(); got != tc.exp {
+				t.Errorf("expected\n%s\nto be\n%s", got, tc.exp)
+			}
+		})
+	}
+}
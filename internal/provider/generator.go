@@ -0,0 +1,156 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	generatorLower   = "abcdefghijklmnopqrstuvwxyz"
+	generatorUpper   = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	generatorNumeric = "0123456789"
+	generatorSpecial = "!@#$%&*()-_=+[]{}<>:?"
+)
+
+// generatorSchema is the schema for the block which configures random
+// plaintext generation.
+func generatorSchema() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"length": {
+				Type:        schema.TypeInt,
+				Description: "Number of characters to generate",
+				Optional:    true,
+				Default:     32,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(1, 4096)),
+			},
+
+			"lower": {
+				Type:        schema.TypeBool,
+				Description: "Include lowercase letters",
+				Optional:    true,
+				Default:     true,
+			},
+
+			"upper": {
+				Type:        schema.TypeBool,
+				Description: "Include uppercase letters",
+				Optional:    true,
+				Default:     true,
+			},
+
+			"numeric": {
+				Type:        schema.TypeBool,
+				Description: "Include numbers",
+				Optional:    true,
+				Default:     true,
+			},
+
+			"special": {
+				Type:        schema.TypeBool,
+				Description: "Include special characters",
+				Optional:    true,
+				Default:     true,
+			},
+
+			"override_special": {
+				Type:        schema.TypeString,
+				Description: "Special characters to use instead of the defaults",
+				Optional:    true,
+			},
+		},
+	}
+}
+
+// generatePlaintext generates a random string from the generator block
+// configuration. The result includes at least one character from each
+// enabled character set, and length counts characters rather than bytes.
+func generatePlaintext(cfg map[string]any) (string, error) {
+	special := generatorSpecial
+	if v, _ := cfg["override_special"].(string); v != "" {
+		special = v
+	}
+
+	var sets [][]rune
+	for _, set := range []struct {
+		key   string
+		chars string
+	}{
+		{"lower", generatorLower},
+		{"upper", generatorUpper},
+		{"numeric", generatorNumeric},
+		{"special", special},
+	} {
+		if enabled, _ := cfg[set.key].(bool); enabled {
+			sets = append(sets, []rune(set.chars))
+		}
+	}
+	if len(sets) == 0 {
+		return "", fmt.Errorf("generator must enable at least one character set")
+	}
+
+	length, _ := cfg["length"].(int)
+	if length < len(sets) {
+		return "", fmt.Errorf("generator length must be at least %d to include every enabled character set", len(sets))
+	}
+
+	var all []rune
+	result := make([]rune, 0, length)
+	for _, set := range sets {
+		all = append(all, set...)
+
+		c, err := randomChar(set)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, c)
+	}
+
+	for len(result) < length {
+		c, err := randomChar(all)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, c)
+	}
+
+	// Shuffle so the guaranteed characters are not always first.
+	for i := len(result) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate random number: %w", err)
+		}
+		result[i], result[j.Int64()] = result[j.Int64()], result[i]
+	}
+
+	return string(result), nil
+}
+
+// randomChar returns a random character from s. Characters are runes, so a
+// multi-byte override_special character is never split.
+func randomChar(s []rune) (rune, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(s))))
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate random number: %w", err)
+	}
+	return s[n.Int64()], nil
+}
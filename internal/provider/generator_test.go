@@ -0,0 +1,115 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGeneratePlaintext(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		cfg  map[string]any
+		sets []string
+		err  bool
+	}{
+		{
+			name: "defaults",
+			cfg: map[string]any{
+				"length":  32,
+				"lower":   true,
+				"upper":   true,
+				"numeric": true,
+				"special": true,
+			},
+			sets: []string{generatorLower, generatorUpper, generatorNumeric, generatorSpecial},
+		},
+		{
+			name: "override_special",
+			cfg: map[string]any{
+				"length":           8,
+				"numeric":          true,
+				"special":          true,
+				"override_special": "_",
+			},
+			sets: []string{generatorNumeric, "_"},
+		},
+		{
+			name: "override_special_multibyte",
+			cfg: map[string]any{
+				"length":           16,
+				"special":          true,
+				"override_special": "§€🔑",
+			},
+			sets: []string{"§€🔑"},
+		},
+		{
+			name: "no_sets",
+			cfg: map[string]any{
+				"length": 8,
+			},
+			err: true,
+		},
+		{
+			name: "too_short",
+			cfg: map[string]any{
+				"length":  1,
+				"lower":   true,
+				"numeric": true,
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := generatePlaintext(tc.cfg)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if tc.err {
+				return
+			}
+
+			if !utf8.ValidString(got) {
+				t.Errorf("expected %q to be valid UTF-8", got)
+			}
+			if n := utf8.RuneCountInString(got); n != tc.cfg["length"].(int) {
+				t.Errorf("expected length %d, got %d", tc.cfg["length"], n)
+			}
+
+			allowed := strings.Join(tc.sets, "")
+			for _, c := range got {
+				if !strings.ContainsRune(allowed, c) {
+					t.Errorf("unexpected character %q in %q", c, got)
+				}
+			}
+
+			for _, set := range tc.sets {
+				if !strings.ContainsAny(got, set) {
+					t.Errorf("expected %q to contain a character from %q", got, set)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// guardrails restricts which buckets, secret names, and KMS keys resources may
+// write to. An empty list allows everything. A nil *guardrails allows
+// everything.
+type guardrails struct {
+	buckets      []*regexp.Regexp
+	namePrefixes []*regexp.Regexp
+	kmsKeys      []*regexp.Regexp
+}
+
+// newGuardrails compiles the given patterns. See compilePattern for the syntax.
+func newGuardrails(buckets, namePrefixes, kmsKeys []string) (*guardrails, error) {
+	var g guardrails
+	var err error
+
+	if g.buckets, err = compilePatterns(buckets, false); err != nil {
+		return nil, fmt.Errorf("allowed_buckets: %w", err)
+	}
+	if g.namePrefixes, err = compilePatterns(namePrefixes, true); err != nil {
+		return nil, fmt.Errorf("allowed_name_prefixes: %w", err)
+	}
+	if g.kmsKeys, err = compilePatterns(kmsKeys, false); err != nil {
+		return nil, fmt.Errorf("allowed_kms_keys: %w", err)
+	}
+	return &g, nil
+}
+
+// CheckBucket returns an error if the sanitized bucket is not allowed.
+func (g *guardrails) CheckBucket(bucket string) error {
+	if g == nil {
+		return nil
+	}
+
+	if bucket = sanitizeBucket(bucket); !matchAny(g.buckets, bucket) {
+		return fmt.Errorf("%q is not allowed by allowed_buckets", bucket)
+	}
+	return nil
+}
+
+// CheckName returns an error if the sanitized secret name does not begin with
+// an allowed prefix. It is also used to check prefixes of many secrets, so an
+// empty name is only allowed if there are no restrictions.
+func (g *guardrails) CheckName(name string) error {
+	if g == nil {
+		return nil
+	}
+
+	if name = sanitizeObject(name); !matchAny(g.namePrefixes, name) {
+		return fmt.Errorf("%q does not begin with any of allowed_name_prefixes", name)
+	}
+	return nil
+}
+
+// CheckKMSKey returns an error if the key is not allowed.
+func (g *guardrails) CheckKMSKey(key string) error {
+	if g == nil {
+		return nil
+	}
+
+	if !matchAny(g.kmsKeys, key) {
+		return fmt.Errorf("%q is not allowed by allowed_kms_keys", key)
+	}
+	return nil
+}
+
+// checkGuardrailsDiff checks the values of the given attributes in the plan
+// against the guardrails. Attributes which are unset in the call or unknown in
+// the plan are skipped, since they are checked again at apply.
+func checkGuardrailsDiff(d *schema.ResourceDiff, meta any, bucketAttr, nameAttr, keyAttr string) error {
+	g := meta.(*config).Guardrails()
+
+	for _, c := range []struct {
+		attr  string
+		check func(string) error
+	}{
+		{bucketAttr, g.CheckBucket},
+		{nameAttr, g.CheckName},
+		{keyAttr, g.CheckKMSKey},
+	} {
+		if c.attr == "" || !d.NewValueKnown(c.attr) {
+			continue
+		}
+		if err := c.check(d.Get(c.attr).(string)); err != nil {
+			return fmt.Errorf("%s: %w", c.attr, err)
+		}
+	}
+	return nil
+}
+
+// guardrailsDiagnostics checks the values of the given attributes against the
+// guardrails at apply, before any API call. Attributes which are unset in the
+// call are skipped.
+func guardrailsDiagnostics(d *schema.ResourceData, meta any, bucketAttr, nameAttr, keyAttr string) diag.Diagnostics {
+	g := meta.(*config).Guardrails()
+
+	for _, c := range []struct {
+		attr  string
+		check func(string) error
+	}{
+		{bucketAttr, g.CheckBucket},
+		{nameAttr, g.CheckName},
+		{keyAttr, g.CheckKMSKey},
+	} {
+		if c.attr == "" {
+			continue
+		}
+		if err := c.check(d.Get(c.attr).(string)); err != nil {
+			return diag.Diagnostics{{
+				Severity:      diag.Error,
+				Summary:       "Blocked by provider guardrails",
+				Detail:        err.Error(),
+				AttributePath: cty.GetAttrPath(c.attr),
+			}}
+		}
+	}
+	return nil
+}
+
+// matchAny returns true if patterns is empty or any pattern matches s.
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string, prefix bool) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := compilePattern(p, prefix)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// compilePattern compiles a glob or, if it is wrapped in slashes like
+// `/^prod-.+$/`, a regular expression. In globs, `*` matches any characters
+// except `/`, `**` matches any characters, and `?` matches one character
+// except `/`. Patterns are anchored at the start, and also at the end unless
+// prefix is true.
+func compilePattern(p string, prefix bool) (*regexp.Regexp, error) {
+	var expr string
+	if len(p) >= 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+		expr = p[1 : len(p)-1]
+	} else {
+		var b strings.Builder
+		for i := 0; i < len(p); i++ {
+			switch {
+			case strings.HasPrefix(p[i:], "**"):
+				b.WriteString(".*")
+				i++
+			case p[i] == '*':
+				b.WriteString("[^/]*")
+			case p[i] == '?':
+				b.WriteString("[^/]")
+			default:
+				b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+			}
+		}
+		expr = b.String()
+	}
+
+	expr = "^(?:" + expr + ")"
+	if !prefix {
+		expr += "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+	}
+	return re, nil
+}
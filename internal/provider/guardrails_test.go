@@ -0,0 +1,112 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"testing"
+)
+
+func TestCompilePattern(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		pattern string
+		prefix  bool
+		in      string
+		match   bool
+	}{
+		{"literal", "my-bucket", false, "my-bucket", true},
+		{"literal_partial", "my-bucket", false, "my-bucket-2", false},
+		{"literal_dot", "a.b", false, "axb", false},
+		{"star", "prod-*", false, "prod-secrets", true},
+		{"star_slash", "projects/p/*", false, "projects/p/a/b", false},
+		{"double_star", "projects/p/**", false, "projects/p/a/b", true},
+		{"question", "bucket-?", false, "bucket-1", true},
+		{"regexp", "/^prod-[0-9]+$/", false, "prod-42", true},
+		{"regexp_anchored", "/prod/", false, "my-prod", false},
+		{"prefix", "app/", true, "app/db-password", true},
+		{"prefix_glob", "team-*/", true, "team-a/db", true},
+		{"prefix_miss", "app/", true, "other/app/db", false},
+		{"prefix_empty", "app/", true, "", false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			re, err := compilePattern(tc.pattern, tc.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := re.MatchString(tc.in); got != tc.match {
+				t.Errorf("expected %q matching %q to be %t", tc.pattern, tc.in, tc.match)
+			}
+		})
+	}
+
+	if _, err := compilePattern("/[/", false); err == nil {
+		t.Error("expected error compiling invalid regular expression")
+	}
+}
+
+func TestGuardrails(t *testing.T) {
+	t.Parallel()
+
+	g, err := newGuardrails(
+		[]string{"prod-*"},
+		[]string{"app/"},
+		[]string{"projects/p/locations/global/keyRings/r/cryptoKeys/*"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Values are sanitized before they are checked
+	if err := g.CheckBucket("gs://prod-secrets/"); err != nil {
+		t.Error(err)
+	}
+	if err := g.CheckName("/app/db-password"); err != nil {
+		t.Error(err)
+	}
+	if err := g.CheckKMSKey("projects/p/locations/global/keyRings/r/cryptoKeys/k"); err != nil {
+		t.Error(err)
+	}
+
+	if err := g.CheckBucket("dev-secrets"); err == nil {
+		t.Error("expected error for bucket")
+	}
+	if err := g.CheckName("other/db-password"); err == nil {
+		t.Error("expected error for name")
+	}
+	if err := g.CheckKMSKey("projects/other/locations/global/keyRings/r/cryptoKeys/k"); err == nil {
+		t.Error("expected error for key")
+	}
+
+	// Nothing is restricted without patterns
+	var none *guardrails
+	if err := none.CheckName(""); err != nil {
+		t.Error(err)
+	}
+	empty, err := newGuardrails(nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := empty.CheckBucket("anything"); err != nil {
+		t.Error(err)
+	}
+}
@@ -15,13 +15,84 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
 
+const (
+	// metadataKMSKeyVersion is the key in the object metadata where the Cloud
+	// KMS key version used to encrypt the secret is recorded. Secrets written
+	// by other tools may not have this key.
+	metadataKMSKeyVersion = "berglas-kms-key-version"
+
+	// metadataExpiresAt is the key in the object metadata where the RFC 3339
+	// expiration time of the secret is recorded.
+	metadataExpiresAt = "berglas-expires-at"
+
+	// metadataRotatedAt and metadataNextRotationAt are the keys in the object
+	// metadata where the RFC 3339 times of the last and next scheduled rotation
+	// are recorded.
+	metadataRotatedAt      = "berglas-rotated-at"
+	metadataNextRotationAt = "berglas-next-rotation-at"
+
+	// metadataDeletionProtection is the key in the object metadata which is
+	// "true" while a berglas_secret with deletion_protection manages it, so
+	// other resources do not delete it.
+	metadataDeletionProtection = "berglas-deletion-protection"
+
+	// metadataCopiedFrom is the key in the object metadata of a copy where the
+	// source secret and generation are recorded.
+	metadataCopiedFrom = "berglas-copied-from"
+)
+
+var (
+	// bucketPermissions are the permissions required on the bucket to manage
+	// secrets.
+	bucketPermissions = []string{
+		"storage.objects.create",
+		"storage.objects.delete",
+		"storage.objects.get",
+	}
+
+	// keyPermissions are the permissions required on the Cloud KMS key to
+	// manage secrets.
+	keyPermissions = []string{
+		"cloudkms.cryptoKeyVersions.useToDecrypt",
+		"cloudkms.cryptoKeyVersions.useToEncrypt",
+	}
+
+	// bucketRegexp matches valid Cloud Storage bucket names.
+	bucketRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$`)
+
+	// kmsKeyRegexp matches fully-qualified Cloud KMS crypto key names. Key
+	// versions are not allowed, since berglas always stores the key name.
+	kmsKeyRegexp = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+	// internalMetadataKeys are the object metadata keys managed by berglas and
+	// this provider.
+	internalMetadataKeys = map[string]struct{}{
+		berglas.MetadataIDKey:      {},
+		berglas.MetadataKMSKey:     {},
+		metadataKMSKeyVersion:      {},
+		metadataExpiresAt:          {},
+		metadataRotatedAt:          {},
+		metadataNextRotationAt:     {},
+		metadataDeletionProtection: {},
+		metadataCopiedFrom:         {},
+	}
+)
+
 // encodeId encodes the ID from the given parts.
 func encodeId(bucket, object string, generation int64) string {
 	bucket, object = sanitizeBucket(bucket), sanitizeObject(object)
@@ -71,6 +142,237 @@ func setMany(d *schema.ResourceData, m resourceFields) error {
 	return nil
 }
 
+// validateBucket validates that the value is a Cloud Storage bucket name,
+// optionally prefixed with gs://.
+func validateBucket(v any, path cty.Path) diag.Diagnostics {
+	s, ok := v.(string)
+	if !ok {
+		return diag.Errorf("expected string, got %T", v)
+	}
+
+	if bucket := sanitizeBucket(s); !bucketRegexp.MatchString(bucket) {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid bucket name",
+			Detail:        fmt.Sprintf("%q is not a valid Cloud Storage bucket name", bucket),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateKMSKey validates that the value is a fully-qualified Cloud KMS key
+// name without a version.
+func validateKMSKey(v any, path cty.Path) diag.Diagnostics {
+	s, ok := v.(string)
+	if !ok {
+		return diag.Errorf("expected string, got %T", v)
+	}
+
+	if !kmsKeyRegexp.MatchString(s) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Invalid Cloud KMS key name",
+			Detail: fmt.Sprintf("%q is not a valid Cloud KMS key name, expected "+
+				"projects/{project}/locations/{location}/keyRings/{key_ring}/cryptoKeys/{key}", s),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateSecretRef validates that the value is a secret reference in the
+// format {bucket}/{object} with an optional #{generation}.
+func validateSecretRef(v any, path cty.Path) diag.Diagnostics {
+	s, ok := v.(string)
+	if !ok {
+		return diag.Errorf("expected string, got %T", v)
+	}
+
+	bucket, object, _, err := decodeId(s)
+	if err == nil && object == "" {
+		err = fmt.Errorf("missing object name")
+	}
+	if err == nil && !bucketRegexp.MatchString(bucket) {
+		err = fmt.Errorf("%q is not a valid Cloud Storage bucket name", bucket)
+	}
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid secret reference",
+			Detail:        fmt.Sprintf("%q is not a valid secret reference: %s", s, err),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateDuration validates that the value is a Go duration string.
+func validateDuration(v any, path cty.Path) diag.Diagnostics {
+	s, ok := v.(string)
+	if !ok {
+		return diag.Errorf("expected string, got %T", v)
+	}
+
+	if _, err := time.ParseDuration(s); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid duration",
+			Detail:        fmt.Sprintf("%q is not a valid duration: %s", s, err),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// validateTimestamp validates that the value is an RFC 3339 timestamp.
+func validateTimestamp(v any, path cty.Path) diag.Diagnostics {
+	s, ok := v.(string)
+	if !ok {
+		return diag.Errorf("expected string, got %T", v)
+	}
+
+	if _, err := time.Parse(time.RFC3339, s); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "Invalid timestamp",
+			Detail:        fmt.Sprintf("%q is not a valid RFC 3339 timestamp: %s", s, err),
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// expiryDiagnostics returns a warning if the secret expires within the warning
+// period, or a diagnostic with the expired severity if it has already expired.
+// An empty expiresAt means the secret does not expire.
+func expiryDiagnostics(name, expiresAt string, warn time.Duration, now time.Time, expired diag.Severity) diag.Diagnostics {
+	if expiresAt == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Invalid secret expiration",
+			Detail: fmt.Sprintf("Secret %q has an invalid expiration time %q in "+
+				"its metadata: %s", name, expiresAt, err),
+			AttributePath: cty.GetAttrPath("expires_at"),
+		}}
+	}
+
+	if !now.Before(t) {
+		return diag.Diagnostics{{
+			Severity: expired,
+			Summary:  "Secret has expired",
+			Detail: fmt.Sprintf("Secret %q expired at %s. Rotate the secret or "+
+				"extend its expiration.", name, expiresAt),
+			AttributePath: cty.GetAttrPath("expires_at"),
+		}}
+	}
+
+	if remaining := t.Sub(now); remaining <= warn {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Secret expires soon",
+			Detail: fmt.Sprintf("Secret %q expires at %s (in %s).", name, expiresAt,
+				remaining.Round(time.Minute)),
+			AttributePath: cty.GetAttrPath("expires_at"),
+		}}
+	}
+
+	return nil
+}
+
+// keyVersionDiagnostics returns a warning if the Cloud KMS key version which
+// encrypted the secret can no longer be used to decrypt it.
+func keyVersionDiagnostics(name string, version *kmspb.CryptoKeyVersion) diag.Diagnostics {
+	switch version.GetState() {
+	case kmspb.CryptoKeyVersion_DISABLED:
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Secret key version is disabled",
+			Detail: fmt.Sprintf("Secret %q is encrypted with %q, which is disabled. "+
+				"The secret cannot be read until the key version is enabled.",
+				name, version.GetName()),
+			AttributePath: cty.GetAttrPath("kms_key_version_state"),
+		}}
+	case kmspb.CryptoKeyVersion_DESTROY_SCHEDULED:
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Secret key version is scheduled for destruction",
+			Detail: fmt.Sprintf("Secret %q is encrypted with %q, which will be "+
+				"destroyed at %s. Restore the key version or re-encrypt the secret "+
+				"before then, or the secret will be permanently unreadable.",
+				name, version.GetName(), version.GetDestroyTime().AsTime().UTC().Format(time.RFC3339)),
+			AttributePath: cty.GetAttrPath("kms_key_version_state"),
+		}}
+	}
+	return nil
+}
+
+// readOnlyDiagnostics returns an error if the provider is read-only. Resources
+// call this before any API call which would mutate a secret.
+func readOnlyDiagnostics(config *config, action, resource string) diag.Diagnostics {
+	if !config.ReadOnly() {
+		return nil
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  "Provider is read-only",
+		Detail: fmt.Sprintf("Refusing to %s %s because the provider is configured "+
+			"with read_only = true. Data sources and refresh are still available.",
+			action, resource),
+	}}
+}
+
+// missingPermissions returns the subset of permissions that the caller does
+// not have on the IAM resource.
+func missingPermissions(ctx context.Context, h *iam.Handle, permissions []string) ([]string, error) {
+	granted, err := h.TestPermissions(ctx, permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	have := make(map[string]struct{}, len(granted))
+	for _, p := range granted {
+		have[p] = struct{}{}
+	}
+
+	var missing []string
+	for _, p := range permissions {
+		if _, ok := have[p]; !ok {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// customMetadata returns a copy of the object metadata without the keys
+// that berglas and this provider use internally.
+func customMetadata(m map[string]string) map[string]string {
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		if _, ok := internalMetadataKeys[k]; ok {
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// hasLabels returns true if m contains every key/value pair in want.
+func hasLabels(m, want map[string]string) bool {
+	for k, v := range want {
+		if got, ok := m[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
 // sanitizeBucket removes any gs:// or trailing / from the bucket name.
 func sanitizeBucket(s string) string {
 	return sanitizeObject(strings.TrimPrefix(s, "gs://"))
@@ -80,3 +382,28 @@ func sanitizeBucket(s string) string {
 func sanitizeObject(s string) string {
 	return strings.Trim(s, "/")
 }
+
+// expandStringMap converts a map from the schema into a map of strings. It
+// returns nil if the map is empty.
+func expandStringMap(m map[string]any) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		s, _ := v.(string)
+		res[k] = s
+	}
+	return res
+}
+
+// expandStringList converts a list from the schema into a list of strings.
+func expandStringList(l []any) []string {
+	res := make([]string, 0, len(l))
+	for _, v := range l {
+		s, _ := v.(string)
+		res = append(res, s)
+	}
+	return res
+}
@@ -0,0 +1,231 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestValidateBucket(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		err  bool
+	}{
+		{"simple", "my-bucket", false},
+		{"gs_prefix", "gs://my-bucket/", false},
+		{"dots", "secrets.example.com", false},
+		{"uppercase", "My-Bucket", true},
+		{"too_short", "ab", true},
+		{"empty", "", true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := validateBucket(tc.in, cty.GetAttrPath("bucket"))
+			if got := diags.HasError(); got != tc.err {
+				t.Errorf("expected error to be %t, got %#v", tc.err, diags)
+			}
+		})
+	}
+}
+
+func TestValidateKMSKey(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		err  bool
+	}{
+		{"valid", "projects/p/locations/global/keyRings/r/cryptoKeys/k", false},
+		{"version", "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", true},
+		{"key_ring", "projects/p/locations/global/keyRings/r", true},
+		{"short_name", "berglas-key", true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := validateKMSKey(tc.in, cty.GetAttrPath("key"))
+			if got := diags.HasError(); got != tc.err {
+				t.Errorf("expected error to be %t, got %#v", tc.err, diags)
+			}
+		})
+	}
+}
+
+func TestValidateSecretRef(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   string
+		err  bool
+	}{
+		{"valid", "my-bucket/path/to/secret", false},
+		{"generation", "my-bucket/secret#1234", false},
+		{"bad_generation", "my-bucket/secret#latest", true},
+		{"no_object", "my-bucket", true},
+		{"bad_bucket", "My_Bucket/secret", true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := validateSecretRef(tc.in, cty.GetAttrPath("source"))
+			if got := diags.HasError(); got != tc.err {
+				t.Errorf("expected error to be %t, got %#v", tc.err, diags)
+			}
+		})
+	}
+}
+
+func TestExpiryDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name      string
+		expiresAt string
+		severity  *diag.Severity
+	}{
+		{"no_expiry", "", nil},
+		{"far_future", "2021-01-01T00:00:00Z", nil},
+		{"within_warning", "2020-01-03T00:00:00Z", severityPtr(diag.Warning)},
+		{"expired", "2019-12-31T00:00:00Z", severityPtr(diag.Error)},
+		{"invalid", "tomorrow", severityPtr(diag.Warning)},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := expiryDiagnostics("my-secret", tc.expiresAt, 7*24*time.Hour, now, diag.Error)
+			if tc.severity == nil {
+				if len(diags) > 0 {
+					t.Fatalf("expected no diagnostics, got %#v", diags)
+				}
+				return
+			}
+
+			if len(diags) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %#v", diags)
+			}
+			if got, want := diags[0].Severity, *tc.severity; got != want {
+				t.Errorf("expected severity %v to be %v", got, want)
+			}
+		})
+	}
+
+	// Resources only warn about expired secrets, so they can be rotated
+	diags := expiryDiagnostics("my-secret", "2019-12-31T00:00:00Z", 7*24*time.Hour, now, diag.Warning)
+	if diags.HasError() {
+		t.Errorf("expected no error, got %#v", diags)
+	}
+}
+
+func TestKeyVersionDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name    string
+		version *kmspb.CryptoKeyVersion
+		warn    bool
+	}{
+		{"unknown", nil, false},
+		{"enabled", &kmspb.CryptoKeyVersion{State: kmspb.CryptoKeyVersion_ENABLED}, false},
+		{"disabled", &kmspb.CryptoKeyVersion{State: kmspb.CryptoKeyVersion_DISABLED}, true},
+		{"destroy_scheduled", &kmspb.CryptoKeyVersion{
+			State:       kmspb.CryptoKeyVersion_DESTROY_SCHEDULED,
+			DestroyTime: timestamppb.New(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		}, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			diags := keyVersionDiagnostics("my-secret", tc.version)
+			if !tc.warn {
+				if len(diags) > 0 {
+					t.Fatalf("expected no diagnostics, got %#v", diags)
+				}
+				return
+			}
+
+			if len(diags) != 1 || diags[0].Severity != diag.Warning {
+				t.Fatalf("expected 1 warning, got %#v", diags)
+			}
+		})
+	}
+}
+
+func severityPtr(s diag.Severity) *diag.Severity {
+	return &s
+}
+
+func TestReadOnlyDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	if diags := readOnlyDiagnostics(&config{}, "create", "berglas_secret"); diags != nil {
+		t.Errorf("expected no diagnostics, got %#v", diags)
+	}
+
+	// The backend is nil, so this panics if the resource makes any API call.
+	readOnly := &config{readOnly: true}
+	for name, fn := range map[string]schema.DeleteContextFunc{
+		"create": resourceBerglasSecretCreate,
+		"update": resourceBerglasSecretUpdate,
+		"delete": resourceBerglasSecretDelete,
+	} {
+		d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+			"bucket":    "my-bucket",
+			"name":      "my-secret",
+			"key":       "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			"plaintext": "value",
+		})
+		d.SetId("my-bucket/my-secret")
+
+		if diags := fn(context.Background(), d, readOnly); !diags.HasError() {
+			t.Errorf("%s: expected error, got %#v", name, diags)
+		}
+	}
+}
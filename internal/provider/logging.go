@@ -0,0 +1,377 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/sethvargo/terraform-provider-berglas/internal/pathorcontents"
+)
+
+// logSubsystem is the name of the tflog subsystem for API calls. Its level is
+// set with TF_LOG_PROVIDER_BERGLAS.
+const logSubsystem = "berglas"
+
+// sensitiveLogFields are field keys whose values are always masked.
+var sensitiveLogFields = []string{
+	"plaintext",
+	"plaintext_json",
+	"access_token",
+	"credentials",
+}
+
+// logContext returns a context with the berglas subsystem and the masks for
+// sensitive values. The masks apply to the subsystem and the provider logger,
+// so they also cover the SDK's own log entries made with the context.
+func logContext(ctx context.Context, masks ...string) context.Context {
+	ctx = tflog.NewSubsystem(ctx, logSubsystem)
+
+	ctx = tflog.MaskFieldValuesWithFieldKeys(ctx, sensitiveLogFields...)
+	ctx = tflog.SubsystemMaskFieldValuesWithFieldKeys(ctx, logSubsystem, sensitiveLogFields...)
+
+	return withLogMasks(ctx, masks...)
+}
+
+// withLogMasks adds masks for sensitive values to a context from logContext.
+// Use it for values which are produced during a call, such as a generated
+// plaintext.
+func withLogMasks(ctx context.Context, masks ...string) context.Context {
+	// Masking the empty string would mask every log entry.
+	values := make([]string, 0, len(masks))
+	for _, v := range masks {
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) > 0 {
+		ctx = tflog.MaskAllFieldValuesStrings(ctx, values...)
+		ctx = tflog.MaskMessageStrings(ctx, values...)
+		ctx = tflog.SubsystemMaskAllFieldValuesStrings(ctx, logSubsystem, values...)
+		ctx = tflog.SubsystemMaskMessageStrings(ctx, logSubsystem, values...)
+	}
+	return ctx
+}
+
+// credentialLogMasks returns the values to mask for the given access_token and
+// credentials, which may each be a path or contents. For credentials JSON, the
+// private key and refresh token are also masked on their own.
+func credentialLogMasks(accessToken, credentials string) []string {
+	var masks []string
+	for _, v := range []string{accessToken, credentials} {
+		if v == "" {
+			continue
+		}
+
+		contents, wasPath, err := pathorcontents.Read(v)
+		if err != nil {
+			continue
+		}
+		masks = append(masks, contents)
+		if wasPath {
+			masks = append(masks, v)
+		}
+
+		var creds map[string]any
+		if err := json.Unmarshal([]byte(contents), &creds); err != nil {
+			continue
+		}
+		for _, k := range []string{"private_key", "refresh_token", "client_secret"} {
+			if s, ok := creds[k].(string); ok {
+				masks = append(masks, s)
+			}
+		}
+	}
+	return masks
+}
+
+// withLogging wraps the CRUD, CustomizeDiff, and import functions of each
+// resource so they run with logContext. The values of sensitive string
+// attributes and the provider credentials are masked.
+func withLogging(resources map[string]*schema.Resource) map[string]*schema.Resource {
+	for _, r := range resources {
+		var sensitive []string
+		for k, s := range r.Schema {
+			if s.Sensitive && s.Type == schema.TypeString {
+				sensitive = append(sensitive, k)
+			}
+		}
+
+		r.CreateContext = withLogContext(r.CreateContext, sensitive)
+		r.ReadContext = withLogContext(r.ReadContext, sensitive)
+		r.UpdateContext = withLogContext(r.UpdateContext, sensitive)
+		r.DeleteContext = withLogContext(r.DeleteContext, sensitive)
+
+		if fn := r.CustomizeDiff; fn != nil {
+			r.CustomizeDiff = func(ctx context.Context, d *schema.ResourceDiff, meta any) error {
+				return fn(logContext(ctx, logMasks(d.Get, meta, sensitive)...), d, meta)
+			}
+		}
+
+		if r.Importer != nil && r.Importer.StateContext != nil {
+			fn := r.Importer.StateContext
+			r.Importer.StateContext = func(ctx context.Context, d *schema.ResourceData, meta any) ([]*schema.ResourceData, error) {
+				return fn(logContext(ctx, logMasks(d.Get, meta, sensitive)...), d, meta)
+			}
+		}
+	}
+	return resources
+}
+
+func withLogContext[F ~func(context.Context, *schema.ResourceData, any) diag.Diagnostics](fn F, sensitive []string) F {
+	if fn == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+		return fn(logContext(ctx, logMasks(d.Get, meta, sensitive)...), d, meta)
+	}
+}
+
+// logMasks returns the provider credentials and the values of the sensitive
+// attributes, read with get.
+func logMasks(get func(string) any, meta any, sensitive []string) []string {
+	var masks []string
+	if config, ok := meta.(*config); ok {
+		masks = append(masks, config.logMasks...)
+	}
+	for _, k := range sensitive {
+		if v, ok := get(k).(string); ok {
+			masks = append(masks, v)
+		}
+	}
+	return masks
+}
+
+// logCall logs an API call and its latency to the berglas subsystem. Fields
+// must never include plaintext.
+func logCall(ctx context.Context, operation string, start time.Time, err error, fields map[string]any) {
+	f := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		f[k] = v
+	}
+	f["operation"] = operation
+	f["latency_ms"] = time.Since(start).Milliseconds()
+
+	if err != nil {
+		f["error"] = err.Error()
+		tflog.SubsystemDebug(ctx, logSubsystem, "API call failed", f)
+		return
+	}
+	tflog.SubsystemDebug(ctx, logSubsystem, "API call", f)
+}
+
+// loggingBackend logs every call to the wrapped backend.
+type loggingBackend struct {
+	backend
+}
+
+func (b *loggingBackend) Create(ctx context.Context, bucket, object, key string, plaintext []byte) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.Create(ctx, bucket, object, key, plaintext)
+	logCall(ctx, "create", start, err, map[string]any{
+		"bucket":     bucket,
+		"object":     object,
+		"key":        key,
+		"generation": attrsGeneration(attrs),
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) Update(ctx context.Context, bucket, object, key string, plaintext []byte,
+	generation, metageneration int64) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.Update(ctx, bucket, object, key, plaintext, generation, metageneration)
+	logCall(ctx, "update", start, err, map[string]any{
+		"bucket":         bucket,
+		"object":         object,
+		"key":            key,
+		"generation":     generation,
+		"new_generation": attrsGeneration(attrs),
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	start := time.Now()
+	plaintext, err := b.backend.Access(ctx, bucket, object, generation)
+	logCall(ctx, "access", start, err, map[string]any{
+		"bucket":     bucket,
+		"object":     object,
+		"generation": generation,
+	})
+	return plaintext, err
+}
+
+func (b *loggingBackend) Attrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.Attrs(ctx, bucket, object, generation)
+	logCall(ctx, "attrs", start, err, map[string]any{
+		"bucket":     bucket,
+		"object":     object,
+		"generation": generation,
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) List(ctx context.Context, bucket, prefix string) ([]*storage.ObjectAttrs, error) {
+	start := time.Now()
+	list, err := b.backend.List(ctx, bucket, prefix)
+	logCall(ctx, "list", start, err, map[string]any{
+		"bucket": bucket,
+		"prefix": prefix,
+		"count":  len(list),
+	})
+	return list, err
+}
+
+func (b *loggingBackend) Generations(ctx context.Context, bucket, object string) ([]*storage.ObjectAttrs, error) {
+	start := time.Now()
+	list, err := b.backend.Generations(ctx, bucket, object)
+	logCall(ctx, "generations", start, err, map[string]any{
+		"bucket": bucket,
+		"object": object,
+		"count":  len(list),
+	})
+	return list, err
+}
+
+func (b *loggingBackend) PatchMetadata(ctx context.Context, bucket, object string, generation, metageneration int64,
+	metadata map[string]string) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.PatchMetadata(ctx, bucket, object, generation, metageneration, metadata)
+	logCall(ctx, "patch_metadata", start, err, map[string]any{
+		"bucket":     bucket,
+		"object":     object,
+		"generation": generation,
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) Rewrap(ctx context.Context, attrs *storage.ObjectAttrs, key string) (*storage.ObjectAttrs, string, error) {
+	start := time.Now()
+	newAttrs, version, err := b.backend.Rewrap(ctx, attrs, key)
+	logCall(ctx, "rewrap", start, err, map[string]any{
+		"bucket":      attrs.Bucket,
+		"object":      attrs.Name,
+		"generation":  attrs.Generation,
+		"key":         key,
+		"key_version": version,
+	})
+	return newAttrs, version, err
+}
+
+func (b *loggingBackend) Restore(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.Restore(ctx, bucket, object, generation)
+	logCall(ctx, "restore", start, err, map[string]any{
+		"bucket":         bucket,
+		"object":         object,
+		"generation":     generation,
+		"new_generation": attrsGeneration(attrs),
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) SoftDeletedAttrs(ctx context.Context, bucket, object string, generation int64) (*storage.ObjectAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.SoftDeletedAttrs(ctx, bucket, object, generation)
+	logCall(ctx, "soft_deleted_attrs", start, err, map[string]any{
+		"bucket":     bucket,
+		"object":     object,
+		"generation": generation,
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) Delete(ctx context.Context, bucket, object string) error {
+	start := time.Now()
+	err := b.backend.Delete(ctx, bucket, object)
+	logCall(ctx, "delete", start, err, map[string]any{
+		"bucket": bucket,
+		"object": object,
+	})
+	return err
+}
+
+func (b *loggingBackend) PrimaryKeyVersion(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	version, err := b.backend.PrimaryKeyVersion(ctx, key)
+	logCall(ctx, "primary_key_version", start, err, map[string]any{
+		"key":         key,
+		"key_version": version,
+	})
+	return version, err
+}
+
+func (b *loggingBackend) KeyVersion(ctx context.Context, name string) (*kmspb.CryptoKeyVersion, error) {
+	start := time.Now()
+	version, err := b.backend.KeyVersion(ctx, name)
+	logCall(ctx, "key_version", start, err, map[string]any{
+		"key_version": name,
+	})
+	return version, err
+}
+
+func (b *loggingBackend) BucketAttrs(ctx context.Context, bucket string) (*storage.BucketAttrs, error) {
+	start := time.Now()
+	attrs, err := b.backend.BucketAttrs(ctx, bucket)
+	logCall(ctx, "bucket_attrs", start, err, map[string]any{
+		"bucket": bucket,
+	})
+	return attrs, err
+}
+
+func (b *loggingBackend) BucketPolicy(ctx context.Context, bucket string) (map[string][]string, error) {
+	start := time.Now()
+	members, err := b.backend.BucketPolicy(ctx, bucket)
+	logCall(ctx, "bucket_policy", start, err, map[string]any{
+		"bucket": bucket,
+		"roles":  len(members),
+	})
+	return members, err
+}
+
+func (b *loggingBackend) MissingBucketPermissions(ctx context.Context, bucket string) ([]string, error) {
+	start := time.Now()
+	missing, err := b.backend.MissingBucketPermissions(ctx, bucket)
+	logCall(ctx, "missing_bucket_permissions", start, err, map[string]any{
+		"bucket": bucket,
+	})
+	return missing, err
+}
+
+func (b *loggingBackend) MissingKeyPermissions(ctx context.Context, key string) ([]string, error) {
+	start := time.Now()
+	missing, err := b.backend.MissingKeyPermissions(ctx, key)
+	logCall(ctx, "missing_key_permissions", start, err, map[string]any{
+		"key": key,
+	})
+	return missing, err
+}
+
+// attrsGeneration returns the generation of attrs, or 0 if attrs is nil.
+func attrsGeneration(attrs *storage.ObjectAttrs) int64 {
+	if attrs == nil {
+		return 0
+	}
+	return attrs.Generation
+}
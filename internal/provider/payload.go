@@ -0,0 +1,339 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// canonicalJSON encodes the map as a compact JSON object with sorted keys, so
+// the same map always produces the same plaintext.
+func canonicalJSON(m map[string]any) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(m); err != nil {
+		return "", fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// Formats of secret payloads which can be parsed into values.
+const (
+	formatRaw        = "raw"
+	formatJSON       = "json"
+	formatYAML       = "yaml"
+	formatDotenv     = "dotenv"
+	formatProperties = "properties"
+)
+
+// parsePayload parses the plaintext in the given format into a map of strings.
+// The raw format returns nil. Errors include the line which failed to parse,
+// but never the plaintext.
+func parsePayload(format, plaintext string) (map[string]string, error) {
+	switch format {
+	case formatRaw:
+		return nil, nil
+	case formatJSON:
+		return flattenJSON(plaintext)
+	case formatYAML:
+		return parseYAML(plaintext)
+	case formatDotenv:
+		return parseDotenv(plaintext)
+	case formatProperties:
+		return parseProperties(plaintext)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// flattenJSON parses a JSON object into a map of strings. String values are
+// unquoted, and all other values are compact JSON.
+func flattenJSON(s string) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &raw); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("line %d: invalid JSON", lineAt(s, syntaxErr.Offset))
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("line %d: expected a JSON object", lineAt(s, typeErr.Offset))
+		default:
+			return nil, fmt.Errorf("plaintext is not a JSON object")
+		}
+	}
+
+	m := make(map[string]string, len(raw))
+	for k, v := range raw {
+		var str string
+		if err := json.Unmarshal(v, &str); err == nil {
+			m[k] = str
+			continue
+		}
+
+		var b bytes.Buffer
+		if err := json.Compact(&b, v); err != nil {
+			return nil, fmt.Errorf("invalid JSON value for %q", k)
+		}
+		m[k] = b.String()
+	}
+	return m, nil
+}
+
+// yamlLineRegexp extracts the line number from a YAML error, which may
+// otherwise include part of the plaintext.
+var yamlLineRegexp = regexp.MustCompile(`line (\d+)`)
+
+// parseYAML parses a YAML mapping into a map of strings. Scalar values are
+// returned as written, and all other values are compact JSON.
+func parseYAML(s string) (map[string]string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(s), &doc); err != nil {
+		if match := yamlLineRegexp.FindStringSubmatch(err.Error()); match != nil {
+			return nil, fmt.Errorf("line %s: invalid YAML", match[1])
+		}
+		return nil, fmt.Errorf("invalid YAML")
+	}
+
+	if doc.Kind == 0 {
+		return map[string]string{}, nil
+	}
+
+	root := &doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a YAML mapping", root.Line)
+	}
+
+	m := make(map[string]string, len(root.Content)/2)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		k, v := root.Content[i], root.Content[i+1]
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: expected a scalar key", k.Line)
+		}
+
+		switch {
+		case v.Kind == yaml.ScalarNode && v.Tag == "!!null":
+			m[k.Value] = ""
+		case v.Kind == yaml.ScalarNode:
+			m[k.Value] = v.Value
+		default:
+			var val any
+			if err := v.Decode(&val); err != nil {
+				return nil, fmt.Errorf("line %d: invalid value for %q", v.Line, k.Value)
+			}
+			b, err := json.Marshal(val)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: value for %q cannot be encoded as JSON", v.Line, k.Value)
+			}
+			m[k.Value] = string(b)
+		}
+	}
+	return m, nil
+}
+
+// dotenvKeyRegexp matches valid dotenv variable names.
+var dotenvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// parseDotenv parses a .env file. Blank lines and lines beginning with # are
+// ignored, and lines may begin with export. Values may be unquoted, single
+// quoted, or double quoted, where double quotes support \n, \t, \", and \\
+// escapes.
+func parseDotenv(s string) (map[string]string, error) {
+	m := make(map[string]string)
+
+	for i, line := range strings.Split(s, "\n") {
+		n := i + 1
+
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		k, v, ok := strings.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || !dotenvKeyRegexp.MatchString(k) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		v = strings.TrimSpace(v)
+
+		switch {
+		case strings.HasPrefix(v, "'"):
+			end := strings.Index(v[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single quote", n)
+			}
+			v = v[1 : end+1]
+		case strings.HasPrefix(v, `"`):
+			var b strings.Builder
+			closed := false
+			for j := 1; j < len(v); j++ {
+				c := v[j]
+				if c == '"' {
+					closed = true
+					break
+				}
+				if c == '\\' && j+1 < len(v) {
+					j++
+					switch v[j] {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					case 'r':
+						b.WriteByte('\r')
+					default:
+						b.WriteByte(v[j])
+					}
+					continue
+				}
+				b.WriteByte(c)
+			}
+			if !closed {
+				return nil, fmt.Errorf("line %d: unterminated double quote", n)
+			}
+			v = b.String()
+		default:
+			// Unquoted values may have a trailing comment.
+			if idx := strings.Index(v, " #"); idx >= 0 {
+				v = strings.TrimSpace(v[:idx])
+			}
+		}
+
+		m[k] = v
+	}
+	return m, nil
+}
+
+// parseProperties parses a Java .properties file. Lines beginning with # or !
+// are comments, keys are separated from values by =, :, or whitespace, and a
+// trailing backslash continues the value on the next line.
+func parseProperties(s string) (map[string]string, error) {
+	m := make(map[string]string)
+
+	lines := strings.Split(s, "\n")
+	for i := 0; i < len(lines); i++ {
+		n := i + 1
+
+		line := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		if line == "" || line[0] == '#' || line[0] == '!' {
+			continue
+		}
+
+		// Join continuation lines, which end in an odd number of backslashes.
+		for trailingBackslashes(line)%2 == 1 {
+			line = line[:len(line)-1]
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("line %d: continuation at end of input", n)
+			}
+			line += strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+		}
+
+		// Find the end of the key, skipping escaped characters.
+		end := len(line)
+		for j := 0; j < len(line); j++ {
+			if line[j] == '\\' {
+				j++
+				continue
+			}
+			if strings.IndexByte("=: \t\f", line[j]) >= 0 {
+				end = j
+				break
+			}
+		}
+
+		rest := strings.TrimLeft(line[end:], " \t\f")
+		if rest != "" && (rest[0] == '=' || rest[0] == ':') {
+			rest = strings.TrimLeft(rest[1:], " \t\f")
+		}
+
+		k, err := unescapeProperty(line[:end])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		v, err := unescapeProperty(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		m[k] = v
+	}
+	return m, nil
+}
+
+// unescapeProperty resolves the escape sequences in a properties key or value.
+func unescapeProperty(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 >= len(s) {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape")
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// trailingBackslashes returns the number of backslashes at the end of s.
+func trailingBackslashes(s string) int {
+	n := 0
+	for i := len(s) - 1; i >= 0 && s[i] == '\\'; i-- {
+		n++
+	}
+	return n
+}
+
+// lineAt returns the 1-based line number of the byte offset in s.
+func lineAt(s string, offset int64) int {
+	if offset > int64(len(s)) {
+		offset = int64(len(s))
+	}
+	return strings.Count(s[:offset], "\n") + 1
+}
@@ -0,0 +1,201 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	t.Parallel()
+
+	got, err := canonicalJSON(map[string]any{
+		"user":     "app",
+		"host":     "db.internal",
+		"password": "p&ss<word>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"host":"db.internal","password":"p&ss<word>","user":"app"}`
+	if got != want {
+		t.Errorf("expected %s to be %s", got, want)
+	}
+}
+
+func TestFlattenJSON(t *testing.T) {
+	t.Parallel()
+
+	got, err := flattenJSON(`{
+		"host": "db.internal",
+		"port": 5432,
+		"tls":  true,
+		"tags": ["a", "b"]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"host": "db.internal",
+		"port": "5432",
+		"tls":  "true",
+		"tags": `["a","b"]`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v to be %v", got, want)
+	}
+
+	// Errors do not include the plaintext
+	for _, in := range []string{"super-secret", `["super-secret"]`} {
+		_, err := flattenJSON(in)
+		if err == nil {
+			t.Fatalf("expected error for %q", in)
+		}
+		if strings.Contains(err.Error(), "super-secret") {
+			t.Errorf("expected %q to not include the plaintext", err)
+		}
+	}
+}
+
+func TestParsePayload(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		format string
+		in     string
+		want   map[string]string
+	}{
+		{
+			name:   "raw",
+			format: formatRaw,
+			in:     "super-secret",
+			want:   nil,
+		},
+		{
+			name:   "json",
+			format: formatJSON,
+			in:     `{"user": "app", "port": 5432}`,
+			want:   map[string]string{"user": "app", "port": "5432"},
+		},
+		{
+			name:   "yaml",
+			format: formatYAML,
+			in:     "user: app\nport: 5432\nempty:\nhosts:\n  - a\n  - b\n",
+			want:   map[string]string{"user": "app", "port": "5432", "empty": "", "hosts": `["a","b"]`},
+		},
+		{
+			name:   "yaml_empty",
+			format: formatYAML,
+			in:     "",
+			want:   map[string]string{},
+		},
+		{
+			name:   "dotenv",
+			format: formatDotenv,
+			in: "# database\n" +
+				"DB_USER=app\n" +
+				"export DB_HOST = db.internal # primary\n" +
+				"DB_PASSWORD='p#ss word'\n" +
+				"DB_OPTIONS=\"a\\nb \\\"c\\\"\"\n" +
+				"\n" +
+				"EMPTY=\n",
+			want: map[string]string{
+				"DB_USER":     "app",
+				"DB_HOST":     "db.internal",
+				"DB_PASSWORD": "p#ss word",
+				"DB_OPTIONS":  "a\nb \"c\"",
+				"EMPTY":       "",
+			},
+		},
+		{
+			name:   "properties",
+			format: formatProperties,
+			in: "# database\n" +
+				"! another comment\n" +
+				"db.user=app\n" +
+				"db.host : db.internal\n" +
+				"db.password secret\n" +
+				"db.url = jdbc:postgresql://db.internal/\\\n" +
+				"    app\n" +
+				"key\\ with\\ spaces = \\u0041\\t\n",
+			want: map[string]string{
+				"db.user":         "app",
+				"db.host":         "db.internal",
+				"db.password":     "secret",
+				"db.url":          "jdbc:postgresql://db.internal/app",
+				"key with spaces": "A\t",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parsePayload(tc.format, tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %q to be %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParsePayload_errors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		format string
+		in     string
+		line   string
+	}{
+		{"json", formatJSON, "{\n  \"password\": \"super-secret\",\n  oops\n}", "line 3:"},
+		{"json_array", formatJSON, "\n[\"super-secret\"]", "line 2:"},
+		{"yaml", formatYAML, "user: app\npassword: super-secret\n  bad: [\n", "line 3:"},
+		{"yaml_list", formatYAML, "- super-secret\n", "line 1:"},
+		{"dotenv", formatDotenv, "USER=app\nsuper-secret\n", "line 2:"},
+		{"dotenv_quote", formatDotenv, "PASSWORD=\"super-secret\n", "line 1:"},
+		{"properties", formatProperties, "user=app\npassword=super-secret\\u12\n", "line 2:"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parsePayload(tc.format, tc.in)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.HasPrefix(err.Error(), tc.line) {
+				t.Errorf("expected %q to begin with %q", err, tc.line)
+			}
+			if strings.Contains(err.Error(), "super-secret") {
+				t.Errorf("expected %q to not include the plaintext", err)
+			}
+		})
+	}
+}
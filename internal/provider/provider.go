@@ -17,16 +17,21 @@ package provider
 import (
 	"context"
 	"fmt"
-	"log"
 	"strings"
 
+	kms "cloud.google.com/go/kms/apiv1"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/storage"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/option"
 
 	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"github.com/mitchellh/go-homedir"
 	"github.com/sethvargo/terraform-provider-berglas/internal/pathorcontents"
 )
 
@@ -70,15 +75,112 @@ OAuth2 access token to use for communicating with Google APIs.
 `),
 					ConflictsWith: []string{"credentials"},
 				},
-			},
 
-			DataSourcesMap: map[string]*schema.Resource{
-				"berglas_secret": dataSourceBerglasSecret(),
-			},
+				"read_only": {
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  false,
+					Description: strings.TrimSpace(`
+Refuse to create, update, or delete secrets. Data sources and refresh continue
+to work, so this is useful for pipelines which only plan.
+`),
+				},
+
+				"read_cache": {
+					Type:     schema.TypeBool,
+					Optional: true,
+					Default:  true,
+					Description: strings.TrimSpace(`
+Cache decrypted secrets for the duration of each Terraform command, so many
+resources and data sources reading the same secret generation only decrypt it
+once.
+`),
+				},
+
+				"allowed_buckets": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Description: strings.TrimSpace(`
+Buckets which resources may write secrets to. Each entry is a glob, where ` + "`*`" + `
+matches any characters except ` + "`/`" + ` and ` + "`**`" + ` matches any characters, or a
+regular expression wrapped in slashes like ` + "`/^prod-.+$/`" + `. Patterns must match
+the entire value. If unset, any bucket is allowed.
+`),
+				},
+
+				"allowed_name_prefixes": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Description: strings.TrimSpace(`
+Prefixes which the names of written secrets must begin with, using the same
+syntax as ` + "`allowed_buckets`" + `. If unset, any name is allowed.
+`),
+				},
+
+				"allowed_kms_keys": {
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+					Description: strings.TrimSpace(`
+Fully-qualified Cloud KMS keys which resources may encrypt secrets with, using
+the same syntax as ` + "`allowed_buckets`" + `. If unset, any key is allowed.
+`),
+				},
+
+				"backend": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  backendGCS,
+					Description: strings.TrimSpace(`
+Where secrets are stored. The default, ` + "`gcs`" + `, stores secrets in Cloud Storage
+and encrypts them with Cloud KMS. ` + "`local`" + ` stores secrets in ` + "`local_directory`" + `
+and encrypts them with a local master key, which is useful for offline
+development and ` + "`terraform test`" + `. Secret Manager secrets are not available
+with the local backend.
+`),
+					ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{
+						backendGCS,
+						backendLocal,
+					}, false)),
+				},
+
+				"local_directory": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Description: strings.TrimSpace(`
+Directory in which the local backend stores secrets. Required when ` + "`backend`" + `
+is ` + "`local`" + `.
+`),
+				},
 
-			ResourcesMap: map[string]*schema.Resource{
-				"berglas_secret": resourceBerglasSecret(),
+				"local_master_key_file": {
+					Type:     schema.TypeString,
+					Optional: true,
+					Description: strings.TrimSpace(`
+Path to the base64-encoded 256-bit master key for the local backend. Defaults
+to ` + "`.master.key`" + ` in ` + "`local_directory`" + `. The key is generated if the file
+does not exist.
+`),
+				},
 			},
+
+			DataSourcesMap: withLogging(map[string]*schema.Resource{
+				"berglas_bucket_posture":             dataSourceBerglasBucketPosture(),
+				"berglas_expiring_secrets":           dataSourceBerglasExpiringSecrets(),
+				"berglas_kubernetes_secret_manifest": dataSourceBerglasKubernetesSecretManifest(),
+				"berglas_secret":                     dataSourceBerglasSecret(),
+				"berglas_secrets":                    dataSourceBerglasSecrets(),
+			}),
+
+			ResourcesMap: withLogging(map[string]*schema.Resource{
+				"berglas_reencrypt":        resourceBerglasReencrypt(),
+				"berglas_secret":           resourceBerglasSecret(),
+				"berglas_secret_copy":      resourceBerglasSecretCopy(),
+				"berglas_secret_migration": resourceBerglasSecretMigration(),
+				"berglas_secret_restore":   resourceBerglasSecretRestore(),
+			}),
 		}
 
 		// Meta, but we have to pass the provider into itself
@@ -91,35 +193,110 @@ OAuth2 access token to use for communicating with Google APIs.
 // providerConfigure configures the provider
 func providerConfigure(version string, p *schema.Provider) schema.ConfigureContextFunc {
 	return func(_ context.Context, d *schema.ResourceData) (any, diag.Diagnostics) {
-		accessToken := d.Get("access_token").(string)
-		credentials := d.Get("credentials").(string)
-
-		// Note that we explicitly use context.Background() instead of the provided
-		// context because we want to give the client a chance to finish before
-		// cleanup.
-		tokenSource, err := tokenSource(context.Background(), accessToken, credentials)
+		guardrails, err := newGuardrails(
+			expandStringList(d.Get("allowed_buckets").([]any)),
+			expandStringList(d.Get("allowed_name_prefixes").([]any)),
+			expandStringList(d.Get("allowed_kms_keys").([]any)),
+		)
 		if err != nil {
-			return nil, diag.FromErr(fmt.Errorf("failed to configure provider: %w", err))
+			return nil, diag.FromErr(err)
 		}
 
-		client, err := berglas.New(context.Background(), option.WithTokenSource(tokenSource))
-		if err != nil {
-			return nil, diag.FromErr(fmt.Errorf("failed to setup berglas: %w", err))
+		if d.Get("backend").(string) == backendLocal {
+			dir := d.Get("local_directory").(string)
+			if dir == "" {
+				return nil, diag.Errorf("local_directory is required when backend is %q", backendLocal)
+			}
+
+			dir, err := homedir.Expand(dir)
+			if err != nil {
+				return nil, diag.FromErr(fmt.Errorf("failed to expand local_directory: %w", err))
+			}
+
+			masterKeyFile, err := homedir.Expand(d.Get("local_master_key_file").(string))
+			if err != nil {
+				return nil, diag.FromErr(fmt.Errorf("failed to expand local_master_key_file: %w", err))
+			}
+
+			backend, err := newLocalBackend(dir, masterKeyFile)
+			if err != nil {
+				return nil, diag.FromErr(fmt.Errorf("failed to setup local backend: %w", err))
+			}
+
+			return &config{
+				backend:    backend,
+				readOnly:   d.Get("read_only").(bool),
+				guardrails: guardrails,
+				readCache:  d.Get("read_cache").(bool),
+			}, nil
 		}
 
+		accessToken := d.Get("access_token").(string)
+		credentials := d.Get("credentials").(string)
+
+		// Credentials are resolved when a resource first needs a client, so
+		// the provider can be configured without them, for example during
+		// terraform validate.
 		config := &config{
-			client: client,
+			newClients: func(ctx context.Context) (*gcsBackend, *secretmanager.Client, error) {
+				return newClients(ctx, accessToken, credentials)
+			},
+			logMasks:   credentialLogMasks(accessToken, credentials),
+			readOnly:   d.Get("read_only").(bool),
+			guardrails: guardrails,
+			readCache:  d.Get("read_cache").(bool),
 		}
 
 		return config, nil
 	}
 }
 
-// tokenSource returns the best token source for the given environment.
-func tokenSource(ctx context.Context, accessToken, credentials string) (oauth2.TokenSource, error) {
+// newClients creates the Cloud Storage backend and Secret Manager client. The
+// context is only used for logging.
+func newClients(ctx context.Context, accessToken, credentials string) (*gcsBackend, *secretmanager.Client, error) {
+	// Note that we explicitly use context.Background() instead of the provided
+	// context because we want to give the client a chance to finish before
+	// cleanup.
+	tokenSource, err := tokenSource(ctx, context.Background(), accessToken, credentials)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure provider: %w", err)
+	}
+
+	client, err := berglas.New(context.Background(), option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup berglas: %w", err)
+	}
+
+	storageClient, err := storage.NewClient(context.Background(), option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup storage: %w", err)
+	}
+
+	kmsClient, err := kms.NewKeyManagementClient(context.Background(), option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup kms: %w", err)
+	}
+
+	smClient, err := secretmanager.NewClient(context.Background(), option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to setup secret manager: %w", err)
+	}
+
+	gcs := &gcsBackend{
+		client:        client,
+		storageClient: storageClient,
+		kmsClient:     kmsClient,
+		httpClient:    oauth2.NewClient(context.Background(), tokenSource),
+	}
+	return gcs, smClient, nil
+}
+
+// tokenSource returns the best token source for the given environment. The
+// logCtx is only used for logging.
+func tokenSource(logCtx, ctx context.Context, accessToken, credentials string) (oauth2.TokenSource, error) {
 	// Try access token first
 	if accessToken != "" {
-		log.Printf("[INFO] authenticating via access_token")
+		tflog.SubsystemInfo(logCtx, logSubsystem, "authenticating via access_token")
 
 		contents, _, err := pathorcontents.Read(accessToken)
 		if err != nil {
@@ -133,7 +310,7 @@ func tokenSource(ctx context.Context, accessToken, credentials string) (oauth2.T
 
 	// Then credentials
 	if credentials != "" {
-		log.Printf("[INFO] authenticating via credentials")
+		tflog.SubsystemInfo(logCtx, logSubsystem, "authenticating via credentials")
 
 		contents, _, err := pathorcontents.Read(credentials)
 		if err != nil {
@@ -149,7 +326,7 @@ func tokenSource(ctx context.Context, accessToken, credentials string) (oauth2.T
 	}
 
 	// Fallback to default credentials
-	log.Printf("[INFO] authenticating via default credentials")
+	tflog.SubsystemInfo(logCtx, logSubsystem, "authenticating via default credentials")
 	source, err := google.DefaultTokenSource(ctx, cloudPlatformScope)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get default credentials: %w", err)
@@ -49,4 +49,12 @@ func testAccKey(tb testing.TB) string {
 	return v
 }
 
+func testAccProject(tb testing.TB) string {
+	v := os.Getenv("TEST_ACC_BERGLAS_PROJECT")
+	if v == "" {
+		tb.Fatal("missing TEST_ACC_BERGLAS_PROJECT")
+	}
+	return v
+}
+
 func testAccPreCheck(tb testing.TB) {}
@@ -0,0 +1,262 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"golang.org/x/sync/errgroup"
+)
+
+func resourceBerglasReencrypt() *schema.Resource {
+	return &schema.Resource{
+		Description: "Re-encrypt the data encryption key of every Berglas secret " +
+			"in a bucket or prefix with the primary version of a Cloud KMS key. " +
+			"The secret contents are not changed, but each re-encrypted object gets " +
+			"a new generation. When the primary version of the key changes, the " +
+			"next plan replaces this resource to re-encrypt again. A `berglas_secret` " +
+			"which manages a re-encrypted object refreshes to the new generation " +
+			"and its `kms_key_version`. If `key` differs from the key of the " +
+			"`berglas_secret`, the secret refreshes to this key, and since `key` " +
+			"forces replacement its next plan replaces the secret, which " +
+			"`deletion_protection` blocks by default. Change `key` on the " +
+			"`berglas_secret` to this key in the same change instead.",
+
+		CreateContext: resourceBerglasReencryptCreate,
+		ReadContext:   schema.NoopContext,
+		UpdateContext: schema.NoopContext,
+		DeleteContext: resourceBerglasReencryptDelete,
+
+		CustomizeDiff: customdiff.All(
+			func(_ context.Context, d *schema.ResourceDiff, meta any) error {
+				return checkGuardrailsDiff(d, meta, "bucket", "prefix", "key")
+			},
+			resourceBerglasReencryptCustomizeDiff,
+		),
+
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket containing the secrets",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"prefix": {
+				Type:        schema.TypeString,
+				Description: "Only re-encrypt secrets whose name begins with this prefix",
+				ForceNew:    true,
+				Optional:    true,
+			},
+
+			"key": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key to encrypt with",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validateKMSKey,
+			},
+
+			"parallelism": {
+				Type:        schema.TypeInt,
+				Description: "Number of secrets to re-encrypt concurrently",
+				Optional:    true,
+				Default:     8,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntBetween(1, 256)),
+			},
+
+			"triggers": {
+				Type:        schema.TypeMap,
+				Description: "Arbitrary values which force re-encryption when changed",
+				ForceNew:    true,
+				Optional:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			//
+			// Computed
+			//
+			"key_version": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key version which was used",
+				ForceNew:    true,
+				Computed:    true,
+			},
+
+			"reencrypted_count": {
+				Type:        schema.TypeInt,
+				Description: "Number of secrets which were re-encrypted",
+				Computed:    true,
+			},
+
+			"skipped_count": {
+				Type: schema.TypeInt,
+				Description: "Number of secrets which were skipped because they " +
+					"were already encrypted with the primary key version or were " +
+					"modified during re-encryption",
+				Computed: true,
+			},
+		},
+	}
+}
+
+// resourceBerglasReencryptCustomizeDiff replaces the resource when the primary
+// version of the key no longer matches the version that was used.
+func resourceBerglasReencryptCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, meta any) error {
+	if d.Id() == "" || !d.NewValueKnown("key") {
+		return nil
+	}
+
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	primary, err := backend.PrimaryKeyVersion(ctx, d.Get("key").(string))
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+
+	if primary != d.Get("key_version").(string) {
+		if err := d.SetNew("key_version", primary); err != nil {
+			return fmt.Errorf("failed to set key_version: %w", err)
+		}
+		if err := d.ForceNew("key_version"); err != nil {
+			return fmt.Errorf("failed to force replacement: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func resourceBerglasReencryptCreate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "create", "berglas_reencrypt"); diags != nil {
+		return diags
+	}
+	if diags := guardrailsDiagnostics(d, meta, "bucket", "prefix", "key"); diags != nil {
+		return diags
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+	prefix := d.Get("prefix").(string)
+	key := d.Get("key").(string)
+
+	primary, err := backend.PrimaryKeyVersion(ctx, key)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var reencrypted, skipped int64
+	var modifiedLock sync.Mutex
+	var modified []string
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(d.Get("parallelism").(int))
+
+	objs, err := backend.List(ctx, bucket, prefix)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to list secrets: %w", err))
+	}
+
+	for _, obj := range objs {
+		obj := obj
+
+		// Skip anything that was not written by berglas
+		if obj.Metadata[berglas.MetadataIDKey] != "1" {
+			continue
+		}
+
+		// Skip secrets which are already encrypted with the primary version
+		if obj.Metadata[berglas.MetadataKMSKey] == key && obj.Metadata[metadataKMSKeyVersion] == primary {
+			atomic.AddInt64(&skipped, 1)
+			continue
+		}
+
+		g.Go(func() error {
+			_, _, err := backend.Rewrap(gctx, obj, key)
+			if errors.Is(err, errObjectModified) {
+				modifiedLock.Lock()
+				modified = append(modified, obj.Name)
+				modifiedLock.Unlock()
+
+				atomic.AddInt64(&skipped, 1)
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to re-encrypt %q: %w", obj.Name, err)
+			}
+
+			atomic.AddInt64(&reencrypted, 1)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return diag.FromErr(err)
+	}
+
+	d.SetId(bucket + "/" + prefix)
+
+	if err := setMany(d, resourceFields{
+		"key_version":       primary,
+		"reencrypted_count": reencrypted,
+		"skipped_count":     skipped,
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	if len(modified) > 0 {
+		sort.Strings(modified)
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Some secrets were not re-encrypted",
+			Detail: fmt.Sprintf("The following secrets were modified during "+
+				"re-encryption and were skipped: %s. Re-run the re-encryption by "+
+				"changing triggers before disabling old key versions.",
+				strings.Join(modified, ", ")),
+		}}
+	}
+
+	return nil
+}
+
+func resourceBerglasReencryptDelete(_ context.Context, d *schema.ResourceData, _ any) diag.Diagnostics {
+	// Re-encryption cannot be undone, so there is nothing to clean up.
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceBerglasReencryptCreate_managedSecret(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	meta := &config{backend: testLocalBackend(t)}
+
+	secret := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+	if diags := resourceBerglasSecretCreate(ctx, secret, meta); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	created := secret.Get("generation").(int)
+
+	// Re-encrypting with the same key version is a no-op, so use another key
+	newKey := testLocalKey + "-new"
+	reencrypt := schema.TestResourceDataRaw(t, resourceBerglasReencrypt().Schema, map[string]any{
+		"bucket": "my-bucket",
+		"key":    newKey,
+	})
+	if diags := resourceBerglasReencryptCreate(ctx, reencrypt, meta); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	// The managed secret follows the re-encrypted generation
+	if diags := resourceBerglasSecretRead(ctx, secret, meta); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got := secret.Get("generation").(int); got == created {
+		t.Errorf("expected generation %d to change", got)
+	}
+	if got, want := secret.Get("plaintext").(string), "value"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := secret.Get("key").(string), newKey; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestAccBerglasReencrypt_basic(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	prefix := "terraform-" + acctest.RandString(24) + "/"
+	name := prefix + "secret"
+	key := testAccKey(t)
+	ctx := context.Background()
+
+	// Create a secret to re-encrypt
+	if _, err := berglas.Create(ctx, &berglas.CreateRequest{
+		Bucket:    bucket,
+		Object:    name,
+		Plaintext: []byte("testing123"),
+		Key:       key,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cleanup the secret
+	defer func() {
+		if err := berglas.Delete(ctx, &berglas.DeleteRequest{
+			Bucket: bucket,
+			Object: name,
+		}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	rn := "berglas_reencrypt.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasReencrypt_basic(t, bucket, prefix, key, "1"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "reencrypted_count", "1"),
+					resource.TestCheckResourceAttr(rn, "skipped_count", "0"),
+					resource.TestCheckResourceAttrSet(rn, "key_version"),
+					testAccCheckBerglasSecretPlaintext(ctx, bucket, name, "testing123"),
+				),
+			},
+			{
+				// Secrets already encrypted with the primary version are skipped
+				Config: testBerglasReencrypt_basic(t, bucket, prefix, key, "2"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "reencrypted_count", "0"),
+					resource.TestCheckResourceAttr(rn, "skipped_count", "1"),
+					testAccCheckBerglasSecretPlaintext(ctx, bucket, name, "testing123"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckBerglasSecretPlaintext(ctx context.Context, bucket, name, want string) resource.TestCheckFunc {
+	return func(_ *terraform.State) error {
+		plaintext, err := berglas.Access(ctx, &berglas.AccessRequest{
+			Bucket: bucket,
+			Object: name,
+		})
+		if err != nil {
+			return err
+		}
+		if got := string(plaintext); got != want {
+			return fmt.Errorf("expected plaintext %q to be %q", got, want)
+		}
+		return nil
+	}
+}
+
+func testBerglasReencrypt_basic(t testing.TB, bucket, prefix, key, trigger string) string {
+	return fmt.Sprintf(`
+resource "berglas_reencrypt" "test" {
+	bucket = "%s"
+	prefix = "%s"
+	key    = "%s"
+
+	triggers = {
+		run = "%s"
+	}
+}
+`, bucket, prefix, key, trigger)
+}
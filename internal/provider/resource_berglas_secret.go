@@ -16,11 +16,26 @@ package provider
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"time"
 
+	"cloud.google.com/go/storage"
 	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+// Values of on_conflict, which controls what happens when a secret being
+// created already exists.
+const (
+	onConflictError     = "error"
+	onConflictAdopt     = "adopt"
+	onConflictOverwrite = "overwrite"
 )
 
 func resourceBerglasSecret() *schema.Resource {
@@ -36,12 +51,51 @@ func resourceBerglasSecret() *schema.Resource {
 			StateContext: resourceBerglasSecretImport,
 		},
 
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceBerglasSecretV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceBerglasSecretStateUpgradeV0,
+			},
+		},
+
+		CustomizeDiff: customdiff.All(
+			resourceBerglasSecretCheckDeletionProtection,
+			resourceBerglasSecretCheckGuardrails,
+			resourceBerglasSecretEncodeJSON,
+			resourceBerglasSecretClearExpiry,
+			resourceBerglasSecretCheckPermissions,
+
+			// Writing the secret creates a new object generation, so anything
+			// derived from the generation is unknown until apply.
+			customdiff.ComputedIf("generation", resourceBerglasSecretWillWrite),
+			customdiff.ComputedIf("metageneration", resourceBerglasSecretWillPatch),
+			customdiff.ComputedIf("kms_key_version", resourceBerglasSecretWillWrite),
+			customdiff.ComputedIf("kms_key_version_state", resourceBerglasSecretWillWrite),
+
+			// A generated plaintext is replaced when the generator changes or the
+			// rotation period has elapsed.
+			customdiff.ComputedIf("plaintext", resourceBerglasSecretWillRotate),
+
+			// The expiration and rotation times are relative to when the secret
+			// is written.
+			customdiff.ComputedIf("expires_at", func(ctx context.Context, d *schema.ResourceDiff, meta any) bool {
+				return d.Get("ttl").(string) != "" &&
+					(resourceBerglasSecretWillWrite(ctx, d, meta) || d.HasChange("ttl"))
+			}),
+			customdiff.ComputedIf("rotated_at", resourceBerglasSecretWillReschedule),
+			customdiff.ComputedIf("next_rotation_at", resourceBerglasSecretWillReschedule),
+		),
+
 		Schema: map[string]*schema.Schema{
 			"bucket": {
 				Type:        schema.TypeString,
 				Description: "Name of the Cloud Storage bucket for the secret",
 				ForceNew:    true,
 				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
 			},
 
 			"name": {
@@ -56,21 +110,120 @@ func resourceBerglasSecret() *schema.Resource {
 				Description: "Fully-qualified name of the Cloud KMS key",
 				ForceNew:    true,
 				Required:    true,
+
+				ValidateDiagFunc: validateKMSKey,
 			},
 
 			"plaintext": {
+				Type:         schema.TypeString,
+				Description:  "Plaintext contents",
+				Optional:     true,
+				Computed:     true,
+				Sensitive:    true,
+				ExactlyOneOf: []string{"plaintext", "plaintext_json", "generator"},
+			},
+
+			"plaintext_json": {
+				Type: schema.TypeMap,
+				Description: "Store a JSON object with these fields instead of setting " +
+					"`plaintext`. Keys are sorted, so the order of the map does not " +
+					"cause a diff, and `plaintext` is set to the encoded object.",
+				Optional:  true,
+				Sensitive: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+
+			"generator": {
+				Type: schema.TypeList,
+				Description: "Generate a random plaintext instead of setting " +
+					"`plaintext`. Changing the generator generates a new value.",
+				Optional: true,
+				MaxItems: 1,
+				Elem:     generatorSchema(),
+			},
+
+			"rotation_period": {
+				Type: schema.TypeString,
+				Description: "Generate a new plaintext once the current generation " +
+					"is older than this duration, such as `2160h`. Requires `generator`.",
+				Optional:     true,
+				RequiredWith: []string{"generator"},
+
+				ValidateDiagFunc: validateDuration,
+			},
+
+			"expires_at": {
+				Type: schema.TypeString,
+				Description: "RFC 3339 timestamp when the secret expires. Reading the " +
+					"secret returns a warning as the expiration approaches and once it " +
+					"has passed, and the `berglas_secret` data source returns an error " +
+					"once it has passed. When `ttl` is set, this is computed from the " +
+					"time the secret was written.",
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"ttl"},
+
+				ValidateDiagFunc: validateTimestamp,
+			},
+
+			"ttl": {
+				Type: schema.TypeString,
+				Description: "Duration after each write when the secret expires, " +
+					"such as `720h`",
+				Optional:      true,
+				ConflictsWith: []string{"expires_at"},
+
+				ValidateDiagFunc: validateDuration,
+			},
+
+			"deletion_protection": {
+				Type: schema.TypeBool,
+				Description: "Prevent the secret from being destroyed or replaced. " +
+					"Set this to `false` and apply before destroying the secret or " +
+					"changing `bucket`, `name`, or `key`. It is also recorded in the " +
+					"object metadata, so `berglas_secret_migration` does not delete " +
+					"the secret with `delete_source`.",
+				Optional: true,
+				Default:  true,
+			},
+
+			"on_conflict": {
+				Type: schema.TypeString,
+				Description: "What to do if the secret already exists when it is " +
+					"created. `error` fails the apply. `adopt` manages the existing " +
+					"secret without writing it, and fails if its key or plaintext " +
+					"differs from the configuration. `overwrite` writes the configured " +
+					"plaintext as a new generation of the existing secret.",
+				Optional: true,
+				Default:  onConflictError,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice(
+					[]string{onConflictError, onConflictAdopt, onConflictOverwrite}, false)),
+			},
+
+			"expiry_warning_period": {
 				Type:        schema.TypeString,
-				Description: "Plaintext contents",
-				Required:    true,
-				Sensitive:   true,
+				Description: "How long before `expires_at` to start warning on read",
+				Optional:    true,
+				Default:     "168h",
+
+				ValidateDiagFunc: validateDuration,
 			},
 
 			//
 			// Computed
 			//
+			"id": {
+				Type:        schema.TypeString,
+				Description: "ID of the secret in the format `{bucket}/{name}`",
+				Computed:    true,
+			},
+
 			"generation": {
 				Type:        schema.TypeInt,
-				Description: "Generation of the object",
+				Description: "Live generation of the object, which is refreshed when the secret is written outside of Terraform",
 				Computed:    true,
 			},
 
@@ -79,35 +232,248 @@ func resourceBerglasSecret() *schema.Resource {
 				Description: "Metageneration of the object",
 				Computed:    true,
 			},
+
+			"rotated_at": {
+				Type:        schema.TypeString,
+				Description: "RFC 3339 timestamp when the current plaintext was written",
+				Computed:    true,
+			},
+
+			"next_rotation_at": {
+				Type: schema.TypeString,
+				Description: "RFC 3339 timestamp after which the next plan generates " +
+					"a new plaintext, if `rotation_period` is set",
+				Computed: true,
+			},
+
+			"kms_key_version": {
+				Type: schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key version which " +
+					"encrypted the secret, if it was recorded when the secret was written",
+				Computed: true,
+			},
+
+			"kms_key_version_state": {
+				Type: schema.TypeString,
+				Description: "State of the Cloud KMS key version, such as `ENABLED` or " +
+					"`DESTROY_SCHEDULED`. Empty if the key version is unknown or the " +
+					"caller cannot view it.",
+				Computed: true,
+			},
 		},
 	}
 }
 
+// resourceBerglasSecretWillWrite returns true if an existing secret will be
+// rewritten by the plan.
+func resourceBerglasSecretWillWrite(ctx context.Context, d *schema.ResourceDiff, meta any) bool {
+	return d.Id() != "" && (d.HasChange("plaintext") || resourceBerglasSecretWillRotate(ctx, d, meta))
+}
+
+// resourceBerglasSecretWillPatch returns true if the plan will change any of
+// the object's metadata, which increments the metageneration.
+func resourceBerglasSecretWillPatch(ctx context.Context, d *schema.ResourceDiff, meta any) bool {
+	return d.Id() != "" && (resourceBerglasSecretWillWrite(ctx, d, meta) ||
+		d.HasChanges("expires_at", "ttl", "rotation_period", "deletion_protection"))
+}
+
+// resourceBerglasSecretWillReschedule returns true if the rotation times will be
+// recomputed by the plan.
+func resourceBerglasSecretWillReschedule(ctx context.Context, d *schema.ResourceDiff, meta any) bool {
+	if d.HasChange("rotation_period") {
+		return true
+	}
+	return d.Get("rotation_period").(string) != "" && resourceBerglasSecretWillWrite(ctx, d, meta)
+}
+
+// resourceBerglasSecretWillRotate returns true if an existing secret uses a
+// generator and a new plaintext should be generated, either because the
+// generator changed or because the rotation period has elapsed.
+func resourceBerglasSecretWillRotate(_ context.Context, d *schema.ResourceDiff, _ any) bool {
+	if d.Id() == "" || len(d.Get("generator").([]any)) == 0 {
+		return false
+	}
+
+	if d.HasChange("generator") {
+		return true
+	}
+
+	next := d.Get("next_rotation_at").(string)
+	if next == "" {
+		return false
+	}
+
+	t, err := time.Parse(time.RFC3339, next)
+	if err != nil {
+		return false
+	}
+	return !time.Now().Before(t)
+}
+
+// resourceBerglasSecretCheckDeletionProtection prevents replacing a secret
+// while deletion_protection is enabled in state. Destroying is checked in
+// resourceBerglasSecretDelete, since CustomizeDiff is not called for destroy.
+func resourceBerglasSecretCheckDeletionProtection(_ context.Context, d *schema.ResourceDiff, _ any) error {
+	if d.Id() == "" || !d.HasChanges("bucket", "name", "key") {
+		return nil
+	}
+
+	if protected, _ := d.GetChange("deletion_protection"); protected.(bool) {
+		return fmt.Errorf("cannot replace %q because deletion_protection is enabled: "+
+			"set deletion_protection = false and apply before changing bucket, name, or key", d.Id())
+	}
+	return nil
+}
+
+// resourceBerglasSecretCheckGuardrails verifies that the bucket, name, and key
+// are allowed by the provider before the secret is written.
+func resourceBerglasSecretCheckGuardrails(ctx context.Context, d *schema.ResourceDiff, meta any) error {
+	if d.Id() != "" && !d.HasChanges("bucket", "name", "key") && !resourceBerglasSecretWillPatch(ctx, d, meta) {
+		return nil
+	}
+	return checkGuardrailsDiff(d, meta, "bucket", "name", "key")
+}
+
+// resourceBerglasSecretClearExpiry plans removing the expiration when neither
+// expires_at nor ttl is configured. expires_at is computed so that ttl can set
+// it, which otherwise keeps the old expiration when both are removed.
+func resourceBerglasSecretClearExpiry(_ context.Context, d *schema.ResourceDiff, _ any) error {
+	cfg := d.GetRawConfig()
+	if d.Id() == "" || cfg.IsNull() ||
+		!cfg.GetAttr("expires_at").IsNull() || !cfg.GetAttr("ttl").IsNull() {
+		return nil
+	}
+
+	if old, _ := d.GetChange("expires_at"); old.(string) == "" {
+		return nil
+	}
+	if err := d.SetNew("expires_at", ""); err != nil {
+		return fmt.Errorf("failed to clear expires_at: %w", err)
+	}
+	return nil
+}
+
+// resourceBerglasSecretEncodeJSON plans plaintext as the canonical encoding of
+// plaintext_json, so the secret is only rewritten when a field changes.
+func resourceBerglasSecretEncodeJSON(_ context.Context, d *schema.ResourceDiff, _ any) error {
+	if !d.HasChange("plaintext_json") {
+		return nil
+	}
+
+	if cfg := d.GetRawConfig(); !cfg.IsNull() && !cfg.GetAttr("plaintext_json").IsWhollyKnown() {
+		return d.SetNewComputed("plaintext")
+	}
+
+	m := d.Get("plaintext_json").(map[string]any)
+	if len(m) == 0 {
+		return nil
+	}
+
+	plaintext, err := canonicalJSON(m)
+	if err != nil {
+		return fmt.Errorf("plaintext_json: %w", err)
+	}
+	return d.SetNew("plaintext", plaintext)
+}
+
+// resourceBerglasSecretCheckPermissions verifies that the caller has permission
+// to write to the bucket and encrypt with the key. This surfaces problems
+// during plan instead of partway through an apply.
+func resourceBerglasSecretCheckPermissions(ctx context.Context, d *schema.ResourceDiff, meta any) error {
+	// A read-only provider is usually planning with an identity which cannot
+	// write, and refuses the write at apply anyway.
+	config := meta.(*config)
+	if config.ReadOnly() {
+		return nil
+	}
+
+	// Only check permissions if the secret will be written.
+	if d.Id() != "" && !d.HasChanges("bucket", "key") && !resourceBerglasSecretWillWrite(ctx, d, meta) {
+		return nil
+	}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return err
+	}
+
+	if d.NewValueKnown("bucket") {
+		bucket := sanitizeBucket(d.Get("bucket").(string))
+
+		missing, err := backend.MissingBucketPermissions(ctx, bucket)
+		if err != nil {
+			return fmt.Errorf("Failed to check permissions on bucket = %q: %w", bucket, err)
+		}
+		if len(missing) > 0 {
+			return missingPermissionsError("bucket", bucket, missing)
+		}
+	}
+
+	if d.NewValueKnown("key") {
+		key := d.Get("key").(string)
+
+		missing, err := backend.MissingKeyPermissions(ctx, key)
+		if err != nil {
+			return fmt.Errorf("Failed to check permissions on key = %q: %w", key, err)
+		}
+		if len(missing) > 0 {
+			return missingPermissionsError("key", key, missing)
+		}
+	}
+
+	return nil
+}
+
 func resourceBerglasSecretCreate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
 	config := meta.(*config)
-	client := config.Client()
+	if diags := readOnlyDiagnostics(config, "create", "berglas_secret"); diags != nil {
+		return diags
+	}
+	if diags := guardrailsDiagnostics(d, meta, "bucket", "name", "key"); diags != nil {
+		return diags
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	bucket := d.Get("bucket").(string)
 	name := d.Get("name").(string)
 	key := d.Get("key").(string)
-	plaintext := d.Get("plaintext").(string)
 
-	secret, err := client.Create(ctx, &berglas.CreateRequest{
-		Bucket:    bucket,
-		Object:    name,
-		Key:       key,
-		Plaintext: []byte(plaintext),
-	})
+	plaintext, err := resourceBerglasSecretPlaintext(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	ctx = withLogMasks(ctx, plaintext)
+
+	secret, err := backend.Create(ctx, bucket, name, key, []byte(plaintext))
+	if errors.Is(err, errObjectExists) && d.Get("on_conflict").(string) != onConflictError {
+		var diags diag.Diagnostics
+		secret, diags = resourceBerglasSecretResolveConflict(ctx, d, backend, plaintext)
+		if diags.HasError() {
+			return diags
+		}
+		err = nil
+	}
 	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to create secret: %w", err))
+		return apiErrorDiagnostics("create secret", err)
 	}
 
-	id := encodeId(bucket, secret.Name, secret.Generation)
+	id := encodeId(bucket, secret.Name, 0)
 	d.SetId(id)
 
+	// Created is when the generation was written, which may be before this
+	// apply if the secret was adopted.
+	generation, metageneration, err := resourceBerglasSecretWriteMetadata(ctx, d, config,
+		secret.Generation, secret.Metageneration, secret.Created, secret.Metadata[metadataKMSKeyVersion])
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
 	if err := setMany(d, resourceFields{
-		"generation":     secret.Generation,
-		"metageneration": secret.Metageneration,
+		"generation":     generation,
+		"metageneration": metageneration,
 	}); err != nil {
 		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
 	}
@@ -115,67 +481,267 @@ func resourceBerglasSecretCreate(ctx context.Context, d *schema.ResourceData, me
 	return resourceBerglasSecretRead(ctx, d, meta)
 }
 
+// resourceBerglasSecretResolveConflict takes over a secret which already exists
+// on create, according to on_conflict. It returns the attributes of the
+// generation which the resource now manages.
+func resourceBerglasSecretResolveConflict(ctx context.Context, d *schema.ResourceData, backend backend,
+	plaintext string) (*storage.ObjectAttrs, diag.Diagnostics) {
+	bucket := d.Get("bucket").(string)
+	name := d.Get("name").(string)
+
+	current, err := backend.Attrs(ctx, bucket, name, 0)
+	if err != nil {
+		return nil, apiErrorDiagnostics("read existing secret", err)
+	}
+
+	if d.Get("on_conflict").(string) == onConflictOverwrite {
+		secret, err := backend.Update(ctx, bucket, name, d.Get("key").(string), []byte(plaintext),
+			current.Generation, current.Metageneration)
+		if err != nil {
+			return nil, apiErrorDiagnostics("overwrite secret", err)
+		}
+		return secret, nil
+	}
+
+	// Adopting must not change the secret, so the configuration has to match
+	// it already. A generated plaintext adopts the existing value.
+	if got, want := current.Metadata[berglas.MetadataKMSKey], d.Get("key").(string); got != want {
+		return nil, diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Cannot adopt secret encrypted with a different key",
+			Detail: fmt.Sprintf("%q already exists and is encrypted with %q. Set key "+
+				"to match, or set on_conflict = %q to re-encrypt it.", name, got, onConflictOverwrite),
+			AttributePath: cty.GetAttrPath("key"),
+		}}
+	}
+
+	if generators := d.Get("generator").([]any); len(generators) == 0 {
+		existing, err := backend.Access(ctx, bucket, name, current.Generation)
+		if err != nil {
+			return nil, apiErrorDiagnostics("read existing secret", err)
+		}
+		if subtle.ConstantTimeCompare(existing, []byte(plaintext)) != 1 {
+			return nil, diag.Diagnostics{{
+				Severity: diag.Error,
+				Summary:  "Cannot adopt secret with a different plaintext",
+				Detail: fmt.Sprintf("%q already exists with a different plaintext. Set "+
+					"on_conflict = %q to write the configured plaintext as a new "+
+					"generation.", name, onConflictOverwrite),
+				AttributePath: cty.GetAttrPath("on_conflict"),
+			}}
+		}
+	}
+
+	return current, nil
+}
+
 func resourceBerglasSecretRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	// A secret which was just created must exist, so only remove secrets which
+	// were deleted outside of Terraform.
+	attrs, diags := readBerglasSecret(ctx, d, meta, !d.IsNewResource())
+	if diags.HasError() || d.Id() == "" {
+		return diags
+	}
+
+	// An expired secret only warns, so that it can still be rotated.
+	diags = append(diags, readBerglasSecretExpiry(d, attrs, diag.Warning)...)
+
+	if err := setMany(d, resourceFields{
+		"rotated_at":       attrs.Metadata[metadataRotatedAt],
+		"next_rotation_at": attrs.Metadata[metadataNextRotationAt],
+	}); err != nil {
+		return append(diags, diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))...)
+	}
+
+	// Detect drift in the fields of a JSON secret. If the secret is no longer a
+	// JSON object, clear the fields so the next plan rewrites it.
+	if len(d.Get("plaintext_json").(map[string]any)) > 0 {
+		m, err := flattenJSON(d.Get("plaintext").(string))
+		if err != nil {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Secret is not a JSON object",
+				Detail: fmt.Sprintf("%q is managed with plaintext_json, but %s. The "+
+					"next apply rewrites it.", d.Id(), err),
+			})
+		}
+		if err := d.Set("plaintext_json", m); err != nil {
+			return append(diags, diag.FromErr(fmt.Errorf("failed to set plaintext_json: %w", err))...)
+		}
+	}
+
+	return diags
+}
+
+// readBerglasSecret reads the secret and its object attributes into the
+// resource data. It is shared by the resource and the data source, which
+// needs the returned attributes. The generation in the ID is read, or the
+// live generation if the ID has none, so the resource follows writes made
+// outside of Terraform. If removeMissing is true and the secret or its key
+// does not exist, the ID is cleared and a warning is returned instead of an error, so
+// Terraform plans to create the secret again.
+func readBerglasSecret(ctx context.Context, d *schema.ResourceData, meta any, removeMissing bool) (*storage.ObjectAttrs, diag.Diagnostics) {
 	config := meta.(*config)
-	client := config.Client()
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return nil, diag.FromErr(err)
+	}
 
 	bucket, object, generation, err := decodeId(d.Id())
 	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
+		return nil, diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
 	}
 
-	secret, err := client.Read(ctx, &berglas.ReadRequest{
-		Bucket:     bucket,
-		Object:     object,
-		Generation: generation,
-	})
+	attrs, err := backend.Attrs(ctx, bucket, object, generation)
 	if err != nil {
-		return diag.FromErr(fmt.Errorf("failed to read secret: %w", err))
+		if removeMissing && isNotFound(err) {
+			return nil, removeMissingSecret(d, err)
+		}
+		return nil, apiErrorDiagnostics("read secret metadata", err)
+	}
+
+	// Check the key version before decrypting, so that a disabled or destroyed
+	// key version is explained instead of surfacing only as a decrypt error.
+	var diags diag.Diagnostics
+	var keyVersionState string
+	if v := attrs.Metadata[metadataKMSKeyVersion]; v != "" {
+		version, err := backend.KeyVersion(ctx, v)
+		if err != nil {
+			if removeMissing && isNotFound(err) {
+				return nil, removeMissingSecret(d, err)
+			}
+			return nil, apiErrorDiagnostics("read key version", err)
+		}
+		if version != nil {
+			keyVersionState = version.GetState().String()
+		}
+		diags = append(diags, keyVersionDiagnostics(object, version)...)
+	}
+
+	plaintext, err := backend.Access(ctx, bucket, object, attrs.Generation)
+	if err != nil {
+		if removeMissing && isNotFound(err) {
+			return nil, append(diags, removeMissingSecret(d, err)...)
+		}
+		return nil, append(diags, apiErrorDiagnostics("read secret", err)...)
 	}
 
 	if err := setMany(d, resourceFields{
-		"bucket":         bucket,
-		"name":           secret.Name,
-		"key":            secret.KMSKey,
-		"plaintext":      string(secret.Plaintext),
-		"generation":     secret.Generation,
-		"metageneration": secret.Metageneration,
+		"bucket":                bucket,
+		"name":                  attrs.Name,
+		"key":                   attrs.Metadata[berglas.MetadataKMSKey],
+		"plaintext":             string(plaintext),
+		"generation":            attrs.Generation,
+		"metageneration":        attrs.Metageneration,
+		"expires_at":            attrs.Metadata[metadataExpiresAt],
+		"kms_key_version":       attrs.Metadata[metadataKMSKeyVersion],
+		"kms_key_version_state": keyVersionState,
 	}); err != nil {
-		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+		return nil, diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
 	}
 
-	return nil
+	return attrs, diags
+}
+
+// readBerglasSecretExpiry returns the expiry diagnostics of the secret which
+// was read, with the given severity if it has expired.
+func readBerglasSecretExpiry(d *schema.ResourceData, attrs *storage.ObjectAttrs, expired diag.Severity) diag.Diagnostics {
+	warn, err := time.ParseDuration(d.Get("expiry_warning_period").(string))
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to parse expiry_warning_period: %w", err))
+	}
+	return expiryDiagnostics(attrs.Name, attrs.Metadata[metadataExpiresAt], warn, time.Now(), expired)
+}
+
+// removeMissingSecret clears the ID of a secret which no longer exists and
+// returns a warning explaining why it will be created again.
+func removeMissingSecret(d *schema.ResourceData, err error) diag.Diagnostics {
+	id := d.Id()
+	d.SetId("")
+
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  "Secret removed from state",
+		Detail: fmt.Sprintf("%q or its Cloud KMS key was deleted outside of "+
+			"Terraform (%s), so it was removed from state and will be created "+
+			"again.", id, err),
+	}}
 }
 
 func resourceBerglasSecretUpdate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
 	config := meta.(*config)
-	client := config.Client()
+	if diags := readOnlyDiagnostics(config, "update", "berglas_secret"); diags != nil {
+		return diags
+	}
 
-	bucket, object, generation, err := decodeId(d.Id())
+	// Changing only deletion_protection does not write the secret.
+	if d.HasChanges("plaintext", "expires_at", "ttl", "rotation_period") {
+		if diags := guardrailsDiagnostics(d, meta, "bucket", "name", "key"); diags != nil {
+			return diags
+		}
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket, object, _, err := decodeId(d.Id())
 	if err != nil {
 		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
 	}
 
+	// The new values are unknown in the plan, so use the values from state as
+	// the preconditions.
+	priorGeneration, _ := d.GetChange("generation")
+	priorMetageneration, _ := d.GetChange("metageneration")
+
 	if d.HasChange("plaintext") {
-		secret, err := client.Update(ctx, &berglas.UpdateRequest{
-			Bucket:         bucket,
-			Object:         object,
-			Generation:     generation,
-			Metageneration: int64(d.Get("metageneration").(int)),
-			Key:            d.Get("key").(string),
-			Plaintext:      []byte(d.Get("plaintext").(string)),
-		})
+		plaintext, err := resourceBerglasSecretPlaintext(d)
 		if err != nil {
-			return diag.FromErr(fmt.Errorf("failed to update secret: %w", err))
+			return diag.FromErr(err)
 		}
+		ctx = withLogMasks(ctx, plaintext)
 
-		id := encodeId(bucket, secret.Name, secret.Generation)
-		d.SetId(id)
+		secret, err := backend.Update(ctx, bucket, object, d.Get("key").(string), []byte(plaintext),
+			int64(priorGeneration.(int)), int64(priorMetageneration.(int)))
+		if err != nil {
+			return apiErrorDiagnostics("update secret", err)
+		}
+
+		generation, metageneration, err := resourceBerglasSecretWriteMetadata(ctx, d, config,
+			secret.Generation, secret.Metageneration, secret.Updated, secret.Metadata[metadataKMSKeyVersion])
+		if err != nil {
+			return diag.FromErr(err)
+		}
+
+		if err := setMany(d, resourceFields{
+			"generation":     generation,
+			"metageneration": metageneration,
+			"plaintext":      plaintext,
+		}); err != nil {
+			return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+		}
+
+		return resourceBerglasSecretRead(ctx, d, meta)
+	}
+
+	if d.HasChanges("expires_at", "ttl", "rotation_period", "deletion_protection") {
+		// Only the metadata changed, so the expiration is relative to when the
+		// current generation was written.
+		current, err := backend.Attrs(ctx, bucket, object, int64(priorGeneration.(int)))
+		if err != nil {
+			return apiErrorDiagnostics("read secret metadata", err)
+		}
+
+		generation, metageneration, err := resourceBerglasSecretWriteMetadata(ctx, d, config,
+			current.Generation, int64(priorMetageneration.(int)), current.Created, "")
+		if err != nil {
+			return diag.FromErr(err)
+		}
 
 		if err := setMany(d, resourceFields{
-			"generation":     secret.Generation,
-			"metageneration": secret.Metageneration,
-			"plaintext":      string(secret.Plaintext),
+			"generation":     generation,
+			"metageneration": metageneration,
 		}); err != nil {
 			return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
 		}
@@ -186,20 +752,129 @@ func resourceBerglasSecretUpdate(ctx context.Context, d *schema.ResourceData, me
 	return nil
 }
 
+// resourceBerglasSecretPlaintext returns the plaintext to write. If a generator
+// is configured, a new random value is generated.
+func resourceBerglasSecretPlaintext(d *schema.ResourceData) (string, error) {
+	generators := d.Get("generator").([]any)
+	if len(generators) == 0 || generators[0] == nil {
+		if m := d.Get("plaintext_json").(map[string]any); len(m) > 0 {
+			return canonicalJSON(m)
+		}
+		return d.Get("plaintext").(string), nil
+	}
+
+	plaintext, err := generatePlaintext(generators[0].(map[string]any))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate plaintext: %w", err)
+	}
+	return plaintext, nil
+}
+
+// resourceBerglasSecretWriteMetadata records the provider-managed metadata on
+// the given object generation and returns the resulting generation and
+// metageneration. berglas replaces the object metadata on every write, so this
+// must be called after each create or update. writtenAt is when the generation
+// was written and keyVersion is the Cloud KMS key version which encrypted it,
+// or empty if the generation was not rewritten.
+func resourceBerglasSecretWriteMetadata(ctx context.Context, d *schema.ResourceData, config *config,
+	generation, metageneration int64, writtenAt time.Time, keyVersion string) (int64, int64, error) {
+	bucket, object, _, err := decodeId(d.Id())
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to decode id: %w", err)
+	}
+
+	expiresAt := d.Get("expires_at").(string)
+	if v := d.Get("ttl").(string); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse ttl: %w", err)
+		}
+		expiresAt = writtenAt.Add(ttl).UTC().Format(time.RFC3339)
+	}
+
+	var rotatedAt, nextRotationAt string
+	if v := d.Get("rotation_period").(string); v != "" {
+		period, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse rotation_period: %w", err)
+		}
+		rotatedAt = writtenAt.UTC().Format(time.RFC3339)
+		nextRotationAt = writtenAt.Add(period).UTC().Format(time.RFC3339)
+	}
+
+	var deletionProtection string
+	if d.Get("deletion_protection").(bool) {
+		deletionProtection = "true"
+	}
+
+	metadata := map[string]string{
+		metadataExpiresAt:          expiresAt,
+		metadataRotatedAt:          rotatedAt,
+		metadataNextRotationAt:     nextRotationAt,
+		metadataDeletionProtection: deletionProtection,
+	}
+
+	// A freshly written generation has no provider metadata, so there is
+	// nothing to clear. Otherwise an empty value clears the key.
+	if d.IsNewResource() || d.HasChange("plaintext") {
+		for k, v := range metadata {
+			if v == "" {
+				delete(metadata, k)
+			}
+		}
+	}
+
+	if keyVersion != "" {
+		metadata[metadataKMSKeyVersion] = keyVersion
+	}
+
+	if len(metadata) == 0 {
+		return generation, metageneration, nil
+	}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	attrs, err := backend.PatchMetadata(ctx, bucket, object,
+		generation, metageneration, metadata)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to write secret metadata: %w", err)
+	}
+	return attrs.Generation, attrs.Metageneration, nil
+}
+
 func resourceBerglasSecretDelete(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
 	config := meta.(*config)
-	client := config.Client()
+	if diags := readOnlyDiagnostics(config, "delete", "berglas_secret"); diags != nil {
+		return diags
+	}
+
+	// Use the value from state, so protection must be disabled in a prior apply.
+	if d.Get("deletion_protection").(bool) {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "Secret is protected from deletion",
+			Detail: fmt.Sprintf("Cannot destroy %q because deletion_protection is "+
+				"enabled. Set deletion_protection = false and apply before destroying "+
+				"or replacing the secret.", d.Id()),
+			AttributePath: cty.GetAttrPath("deletion_protection"),
+		}}
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
 	bucket, object, _, err := decodeId(d.Id())
 	if err != nil {
 		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
 	}
 
-	if err := client.Delete(ctx, &berglas.DeleteRequest{
-		Bucket: bucket,
-		Object: object,
-	}); err != nil {
-		return diag.FromErr(fmt.Errorf("failed to delete secret: %w", err))
+	// A secret which was already deleted does not need to be deleted again.
+	if err := backend.Delete(ctx, bucket, object); err != nil && !isNotFound(err) {
+		return apiErrorDiagnostics("delete secret", err)
 	}
 
 	d.SetId("")
@@ -208,15 +883,19 @@ func resourceBerglasSecretDelete(ctx context.Context, d *schema.ResourceData, me
 }
 
 func resourceBerglasSecretImport(ctx context.Context, d *schema.ResourceData, meta any) ([]*schema.ResourceData, error) {
-	bucket, object, generation, err := decodeId(d.Id())
+	bucket, object, _, err := decodeId(d.Id())
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode id: %w", err)
 	}
 
+	// The resource follows the live generation, so a generation in the ID is
+	// ignored.
+	d.SetId(encodeId(bucket, object, 0))
+
 	if err := setMany(d, resourceFields{
-		"bucket":     bucket,
-		"name":       object,
-		"generation": generation,
+		"bucket":              bucket,
+		"name":                object,
+		"deletion_protection": true,
 	}); err != nil {
 		return nil, fmt.Errorf("failed to update resource fields: %w", err)
 	}
@@ -224,6 +903,9 @@ func resourceBerglasSecretImport(ctx context.Context, d *schema.ResourceData, me
 	if diag := resourceBerglasSecretRead(ctx, d, meta); diag.HasError() {
 		return nil, fmt.Errorf("failed to read secret")
 	}
+	if d.Id() == "" {
+		return nil, fmt.Errorf("secret %q does not exist", encodeId(bucket, object, 0))
+	}
 
 	return []*schema.ResourceData{d}, nil
 }
@@ -0,0 +1,376 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func resourceBerglasSecretCopy() *schema.Resource {
+	return &schema.Resource{
+		Description: "Copy a Berglas secret to another bucket, name, or key. The " +
+			"secret is decrypted and re-encrypted with the destination key. When " +
+			"the source secret changes, the next plan updates the copy.",
+
+		CreateContext: resourceBerglasSecretCopyCreate,
+		ReadContext:   resourceBerglasSecretCopyRead,
+		UpdateContext: resourceBerglasSecretCopyUpdate,
+		DeleteContext: resourceBerglasSecretCopyDelete,
+
+		CustomizeDiff: customdiff.All(
+			func(_ context.Context, d *schema.ResourceDiff, meta any) error {
+				return checkGuardrailsDiff(d, meta, "bucket", "name", "key")
+			},
+			resourceBerglasSecretCopyCheckSource,
+
+			// Copying creates a new object generation.
+			customdiff.ComputedIf("generation", resourceBerglasSecretCopyWillWrite),
+			customdiff.ComputedIf("metageneration", resourceBerglasSecretCopyWillWrite),
+			customdiff.ComputedIf("kms_key_version", resourceBerglasSecretCopyWillWrite),
+		),
+
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Type: schema.TypeString,
+				Description: "Secret to copy in the format `{bucket}/{name}`, such as " +
+					"the `id` of a `berglas_secret`. Append `#{generation}` to copy a " +
+					"specific generation instead of following the latest.",
+				Required: true,
+
+				ValidateDiagFunc: validateSecretRef,
+			},
+
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket for the copy",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"name": {
+				Type:        schema.TypeString,
+				Description: "Name of the copy in the bucket",
+				ForceNew:    true,
+				Required:    true,
+			},
+
+			"key": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key to encrypt the copy with",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validateKMSKey,
+			},
+
+			//
+			// Computed
+			//
+			"id": {
+				Type:        schema.TypeString,
+				Description: "ID of the copy in the format `{bucket}/{name}`",
+				Computed:    true,
+			},
+
+			"source_generation": {
+				Type:        schema.TypeInt,
+				Description: "Generation of the source secret which was copied",
+				Computed:    true,
+			},
+
+			"generation": {
+				Type:        schema.TypeInt,
+				Description: "Generation of the copy",
+				Computed:    true,
+			},
+
+			"metageneration": {
+				Type:        schema.TypeInt,
+				Description: "Metageneration of the copy",
+				Computed:    true,
+			},
+
+			"kms_key_version": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key version which encrypted the copy",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+// resourceBerglasSecretCopyCheckSource plans an update of the copy when the
+// source changes or has a different generation than the one which was copied.
+func resourceBerglasSecretCopyCheckSource(ctx context.Context, d *schema.ResourceDiff, meta any) error {
+	// The source may not exist until apply when the copy is created.
+	if d.Id() == "" {
+		return nil
+	}
+
+	// A new source is read at apply, so the old source_generation must not
+	// be copied from it.
+	if !d.NewValueKnown("source") || d.HasChange("source") {
+		return d.SetNewComputed("source_generation")
+	}
+
+	config := meta.(*config)
+
+	// If the source cannot be read, keep the existing copy. Refresh reports
+	// the problem as a warning.
+	attrs, err := resourceBerglasSecretCopySourceAttrs(ctx, config, d.Get("source").(string))
+	if err != nil {
+		return nil
+	}
+
+	if int64(d.Get("source_generation").(int)) != attrs.Generation {
+		if err := d.SetNew("source_generation", attrs.Generation); err != nil {
+			return fmt.Errorf("failed to set source_generation: %w", err)
+		}
+	}
+	return nil
+}
+
+// resourceBerglasSecretCopyWillWrite returns true if the plan will write a new
+// generation of the copy.
+func resourceBerglasSecretCopyWillWrite(_ context.Context, d *schema.ResourceDiff, _ any) bool {
+	return d.Id() != "" && d.HasChanges("source", "source_generation")
+}
+
+func resourceBerglasSecretCopyCreate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "create", "berglas_secret_copy"); diags != nil {
+		return diags
+	}
+	if diags := guardrailsDiagnostics(d, meta, "bucket", "name", "key"); diags != nil {
+		return diags
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+	name := sanitizeObject(d.Get("name").(string))
+
+	if diags := resourceBerglasSecretCopyWrite(ctx, d, meta, bucket, name, 0, 0); diags.HasError() {
+		return diags
+	}
+
+	d.SetId(encodeId(bucket, name, 0))
+
+	return resourceBerglasSecretCopyRead(ctx, d, meta)
+}
+
+func resourceBerglasSecretCopyRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket, object, _, err := decodeId(d.Id())
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
+	}
+
+	// Read the live generation, since the copy may have been overwritten.
+	attrs, err := backend.Attrs(ctx, bucket, object, 0)
+	if err != nil {
+		if !d.IsNewResource() && isNotFound(err) {
+			return removeMissingSecret(d, err)
+		}
+		return apiErrorDiagnostics("read copy", err)
+	}
+
+	if err := setMany(d, resourceFields{
+		"bucket":          bucket,
+		"name":            attrs.Name,
+		"generation":      attrs.Generation,
+		"metageneration":  attrs.Metageneration,
+		"kms_key_version": attrs.Metadata[metadataKMSKeyVersion],
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	// The copy is still usable if the source cannot be read, for example
+	// because it was deleted.
+	source, err := resourceBerglasSecretCopySourceAttrs(ctx, config, d.Get("source").(string))
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Failed to read source secret",
+			Detail:   fmt.Sprintf("Unable to check whether %q is stale: %s", d.Id(), err),
+		}}
+	}
+
+	if copied := int64(d.Get("source_generation").(int)); copied != source.Generation {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Secret copy is stale",
+			Detail: fmt.Sprintf("%q was copied from generation %d of %q, but the "+
+				"source is now at generation %d. The next apply updates the copy.",
+				d.Id(), copied, d.Get("source").(string), source.Generation),
+		}}
+	}
+
+	return nil
+}
+
+func resourceBerglasSecretCopyUpdate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "update", "berglas_secret_copy"); diags != nil {
+		return diags
+	}
+	if diags := guardrailsDiagnostics(d, meta, "bucket", "name", "key"); diags != nil {
+		return diags
+	}
+
+	bucket, object, _, err := decodeId(d.Id())
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
+	}
+
+	if d.HasChanges("source", "source_generation") {
+		priorGeneration, _ := d.GetChange("generation")
+		priorMetageneration, _ := d.GetChange("metageneration")
+
+		if diags := resourceBerglasSecretCopyWrite(ctx, d, meta, bucket, object,
+			int64(priorGeneration.(int)), int64(priorMetageneration.(int))); diags.HasError() {
+			return diags
+		}
+	}
+
+	return resourceBerglasSecretCopyRead(ctx, d, meta)
+}
+
+func resourceBerglasSecretCopyDelete(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "delete", "berglas_secret_copy"); diags != nil {
+		return diags
+	}
+
+	bucket, object, _, err := decodeId(d.Id())
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
+	}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// A copy which was already deleted does not need to be deleted again.
+	if err := backend.Delete(ctx, bucket, object); err != nil && !isNotFound(err) {
+		return apiErrorDiagnostics("delete copy", err)
+	}
+
+	d.SetId("")
+
+	return nil
+}
+
+// resourceBerglasSecretCopyWrite copies the source secret to the destination.
+// If generation is 0, the destination is created, otherwise it is updated with
+// the generation and metageneration as preconditions.
+func resourceBerglasSecretCopyWrite(ctx context.Context, d *schema.ResourceData, meta any,
+	bucket, object string, generation, metageneration int64) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	source := d.Get("source").(string)
+	srcBucket, srcObject, srcGeneration, err := decodeId(source)
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode source: %w", err))
+	}
+
+	// Copy the generation from the plan, so the copy matches what was planned
+	// even if the source changed since.
+	if v := int64(d.Get("source_generation").(int)); v != 0 && srcGeneration == 0 {
+		srcGeneration = v
+	}
+
+	srcAttrs, err := backend.Attrs(ctx, srcBucket, srcObject, srcGeneration)
+	if err != nil {
+		return apiErrorDiagnostics("read source metadata", err)
+	}
+
+	plaintext, err := backend.Access(ctx, srcBucket, srcObject, srcAttrs.Generation)
+	if err != nil {
+		return apiErrorDiagnostics("read source", err)
+	}
+
+	key := d.Get("key").(string)
+
+	var attrs *storage.ObjectAttrs
+	if generation == 0 {
+		attrs, err = backend.Create(ctx, bucket, object, key, plaintext)
+	} else {
+		attrs, err = backend.Update(ctx, bucket, object, key, plaintext, generation, metageneration)
+	}
+	if err != nil {
+		return apiErrorDiagnostics("write copy", err)
+	}
+
+	// berglas replaces the metadata on every write, so copy the labels and
+	// expiration of the source and record the key version.
+	metadata := customMetadata(srcAttrs.Metadata)
+	if v := srcAttrs.Metadata[metadataExpiresAt]; v != "" {
+		metadata[metadataExpiresAt] = v
+	}
+	metadata[metadataKMSKeyVersion] = attrs.Metadata[metadataKMSKeyVersion]
+	metadata[metadataCopiedFrom] = encodeId(srcBucket, srcObject, srcAttrs.Generation)
+
+	attrs, err = backend.PatchMetadata(ctx, bucket, object, attrs.Generation, attrs.Metageneration, metadata)
+	if err != nil {
+		return apiErrorDiagnostics("write copy metadata", err)
+	}
+
+	if err := setMany(d, resourceFields{
+		"source_generation": srcAttrs.Generation,
+		"generation":        attrs.Generation,
+		"metageneration":    attrs.Metageneration,
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return nil
+}
+
+// resourceBerglasSecretCopySourceAttrs returns the attributes of the source
+// secret. If the source includes a generation, that generation is returned.
+func resourceBerglasSecretCopySourceAttrs(ctx context.Context, config *config, source string) (*storage.ObjectAttrs, error) {
+	bucket, object, generation, err := decodeId(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode source: %w", err)
+	}
+
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs, err := backend.Attrs(ctx, bucket, object, generation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", source, err)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccBerglasSecretCopy_basic(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+	ctx := context.Background()
+
+	rn := "berglas_secret_copy.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name+"-copy"),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecretCopy_basic(t, bucket, name, key, "before"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "id", bucket+"/"+name+"-copy"),
+					resource.TestCheckResourceAttrPair(rn, "source_generation", "berglas_secret.test", "generation"),
+					resource.TestCheckResourceAttrSet(rn, "kms_key_version"),
+					testAccCheckBerglasSecretPlaintext(ctx, bucket, name+"-copy", "before"),
+				),
+			},
+			{
+				// Changing the source updates the copy
+				Config: testBerglasSecretCopy_basic(t, bucket, name, key, "after"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrPair(rn, "source_generation", "berglas_secret.test", "generation"),
+					testAccCheckBerglasSecretPlaintext(ctx, bucket, name+"-copy", "after"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceBerglasSecretCopyDiff_sourceChange(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+	meta := &config{backend: backend}
+
+	for _, name := range []string{"a", "b"} {
+		if _, err := backend.Create(ctx, "my-bucket", name, testLocalKey, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw := map[string]any{
+		"source": "my-bucket/a",
+		"bucket": "my-bucket",
+		"name":   "copy",
+		"key":    testLocalKey,
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretCopy().Schema, raw)
+	if diags := resourceBerglasSecretCopyCreate(ctx, d, meta); diags.HasError() {
+		t.Fatalf("create: %v", diags)
+	}
+
+	// The new source is read at apply, even if it is unreadable at plan
+	for _, source := range []string{"my-bucket/b", "my-bucket/missing"} {
+		raw["source"] = source
+		diff, err := resourceBerglasSecretCopy().Diff(ctx, d.State(), terraform.NewResourceConfigRaw(raw), meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff == nil || diff.Attributes["source_generation"] == nil || !diff.Attributes["source_generation"].NewComputed {
+			t.Errorf("%s: expected source_generation to be unknown, got %#v", source, diff)
+		}
+	}
+}
+
+func TestResourceBerglasSecretCopyDelete_missing(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretCopy().Schema, map[string]any{
+		"source": "my-bucket/a",
+		"bucket": "my-bucket",
+		"name":   "copy",
+		"key":    testLocalKey,
+	})
+	d.SetId("my-bucket/copy")
+
+	diags := resourceBerglasSecretCopyDelete(context.Background(), d, &config{backend: testLocalBackend(t)})
+	if diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got := d.Id(); got != "" {
+		t.Errorf("expected %q to be removed from state", got)
+	}
+}
+
+func testBerglasSecretCopy_basic(t testing.TB, bucket, name, key, plaintext string) string {
+	return testBerglasSecret_plaintext(t, bucket, name, key, plaintext) + fmt.Sprintf(`
+
+resource "berglas_secret_copy" "test" {
+	source = "${berglas_secret.test.id}#${berglas_secret.test.generation}"
+
+	bucket = "%s"
+	name   = "%s-copy"
+	key    = "%s"
+}`, bucket, name, key)
+}
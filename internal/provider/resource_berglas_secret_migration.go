@@ -0,0 +1,506 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/customdiff"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+const (
+	migrateLatest = "latest"
+	migrateAll    = "all"
+
+	// labelMigratedGeneration is the label on the Secret Manager secret which
+	// records the newest generation that was added as a version, so that a
+	// migration which is retried does not add the same generations again.
+	labelMigratedGeneration = "berglas-migrated-generation"
+)
+
+// secretManagerNameRegexp matches valid Secret Manager secret IDs.
+var secretManagerNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,255}$`)
+
+func resourceBerglasSecretMigration() *schema.Resource {
+	return &schema.Resource{
+		Description: "Migrate a Berglas secret from Cloud Storage to Secret " +
+			"Manager. Each migrated generation becomes a new version of the Secret " +
+			"Manager secret. The newest migrated generation is recorded in the " +
+			"`berglas-migrated-generation` label of the Secret Manager secret, so a " +
+			"migration which is retried after a failure skips the generations which " +
+			"were already added. Destroying this resource does not delete the " +
+			"Secret Manager secret.",
+
+		CreateContext: resourceBerglasSecretMigrationCreate,
+		ReadContext:   resourceBerglasSecretMigrationRead,
+		DeleteContext: resourceBerglasSecretMigrationDelete,
+
+		CustomizeDiff: customdiff.All(
+			resourceBerglasSecretMigrationCheckGuardrails,
+			resourceBerglasSecretMigrationCheckName,
+		),
+
+		Schema: map[string]*schema.Schema{
+			"source": {
+				Type: schema.TypeString,
+				Description: "Secret to migrate in the format `{bucket}/{name}`, such " +
+					"as the `id` of a `berglas_secret`",
+				ForceNew: true,
+				Required: true,
+
+				ValidateDiagFunc: validateSecretRef,
+			},
+
+			"project": {
+				Type:        schema.TypeString,
+				Description: "ID of the project in which to create the Secret Manager secret",
+				ForceNew:    true,
+				Required:    true,
+			},
+
+			"name": {
+				Type: schema.TypeString,
+				Description: "Name of the Secret Manager secret. Defaults to the name " +
+					"of the source with `/` replaced by `_`, like `berglas migrate`. " +
+					"Set it when the source name contains other characters which " +
+					"Secret Manager does not allow, such as `.`.",
+				ForceNew: true,
+				Optional: true,
+				Computed: true,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringMatch(
+					secretManagerNameRegexp, "must contain only letters, numbers, underscores, and hyphens")),
+			},
+
+			"generations": {
+				Type: schema.TypeString,
+				Description: "Which generations of the source to migrate, either " +
+					"`latest` or `all`. With `all`, generations are added as versions " +
+					"from oldest to newest.",
+				ForceNew: true,
+				Optional: true,
+				Default:  migrateLatest,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.StringInSlice([]string{
+					migrateLatest,
+					migrateAll,
+				}, false)),
+			},
+
+			"delete_source": {
+				Type: schema.TypeBool,
+				Description: "Delete the source secret after it is migrated. The " +
+					"migration fails if a `berglas_secret` with `deletion_protection` " +
+					"manages the source; set `deletion_protection = false` and apply " +
+					"first. Secrets imported or last written before deletion " +
+					"protection was recorded in their metadata are not detected.",
+				ForceNew: true,
+				Optional: true,
+				Default:  false,
+			},
+
+			//
+			// Computed
+			//
+			"reference": {
+				Type:        schema.TypeString,
+				Description: "Berglas reference to the Secret Manager secret, such as `sm://my-project/my-secret`",
+				Computed:    true,
+			},
+
+			"version": {
+				Type:        schema.TypeString,
+				Description: "Latest Secret Manager version created by the migration",
+				Computed:    true,
+			},
+
+			"migrated_generations": {
+				Type:        schema.TypeList,
+				Description: "Generations of the source which were migrated, oldest first",
+				Computed:    true,
+				Elem: &schema.Schema{
+					Type: schema.TypeInt,
+				},
+			},
+		},
+	}
+}
+
+// resourceBerglasSecretMigrationCheckGuardrails verifies that the source may be
+// deleted when delete_source is set.
+func resourceBerglasSecretMigrationCheckGuardrails(_ context.Context, d *schema.ResourceDiff, meta any) error {
+	if !d.Get("delete_source").(bool) || !d.NewValueKnown("source") {
+		return nil
+	}
+	return resourceBerglasSecretMigrationGuardrails(meta.(*config), d.Get("source").(string))
+}
+
+// resourceBerglasSecretMigrationCheckName verifies that the default name derived
+// from the source is a valid Secret Manager secret ID, so an invalid name fails
+// the plan instead of the apply after the source was read.
+func resourceBerglasSecretMigrationCheckName(_ context.Context, d *schema.ResourceDiff, _ any) error {
+	// name is computed, so only the configuration shows whether it is set.
+	if d.Id() != "" || !d.NewValueKnown("source") {
+		return nil
+	}
+	if cfg := d.GetRawConfig(); cfg.IsNull() || !cfg.GetAttr("name").IsNull() {
+		return nil
+	}
+
+	_, object, _, err := decodeId(d.Get("source").(string))
+	if err != nil {
+		return fmt.Errorf("failed to decode source: %w", err)
+	}
+	_, err = resourceBerglasSecretMigrationDefaultName(object)
+	return err
+}
+
+// resourceBerglasSecretMigrationDefaultName returns the Secret Manager secret
+// ID for the object when name is not set, which is the object name with `/`
+// replaced by `_` like `berglas migrate`. It returns an error if the result is
+// not a valid secret ID.
+func resourceBerglasSecretMigrationDefaultName(object string) (string, error) {
+	name := strings.ReplaceAll(object, "/", "_")
+	if !secretManagerNameRegexp.MatchString(name) {
+		return "", fmt.Errorf("name: the default name %q derived from the source is "+
+			"not a valid Secret Manager secret ID, which must contain only letters, "+
+			"numbers, underscores, and hyphens. Set name explicitly.", name)
+	}
+	return name, nil
+}
+
+// resourceBerglasSecretMigrationGuardrails returns an error if the guardrails
+// do not allow writing to the source.
+func resourceBerglasSecretMigrationGuardrails(config *config, source string) error {
+	bucket, object, _, err := decodeId(source)
+	if err != nil {
+		return fmt.Errorf("failed to decode source: %w", err)
+	}
+
+	g := config.Guardrails()
+	if err := g.CheckBucket(bucket); err != nil {
+		return fmt.Errorf("source: cannot delete source: %w", err)
+	}
+	if err := g.CheckName(object); err != nil {
+		return fmt.Errorf("source: cannot delete source: %w", err)
+	}
+	return nil
+}
+
+func resourceBerglasSecretMigrationCreate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "create", "berglas_secret_migration"); diags != nil {
+		return diags
+	}
+	if d.Get("delete_source").(bool) {
+		if err := resourceBerglasSecretMigrationGuardrails(config, d.Get("source").(string)); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket, object, _, err := decodeId(d.Get("source").(string))
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode source: %w", err))
+	}
+
+	name := d.Get("name").(string)
+	if name == "" {
+		if name, err = resourceBerglasSecretMigrationDefaultName(object); err != nil {
+			return diag.FromErr(err)
+		}
+	}
+
+	// Check before migrating, so a protected source is not migrated and left
+	// in place.
+	if d.Get("delete_source").(bool) {
+		if diags := resourceBerglasSecretMigrationCheckProtection(ctx, backend, bucket, object); diags != nil {
+			return diags
+		}
+	}
+
+	client, err := config.Client(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	smClient, err := config.SecretManagerClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	project := d.Get("project").(string)
+
+	var generations []*storage.ObjectAttrs
+	if d.Get("generations").(string) == migrateAll {
+		generations, err = backend.Generations(ctx, bucket, object)
+		if err != nil {
+			return diag.FromErr(fmt.Errorf("failed to list generations: %w", err))
+		}
+	} else {
+		attrs, err := backend.Attrs(ctx, bucket, object, 0)
+		if err != nil {
+			return diag.FromErr(fmt.Errorf("failed to read source metadata: %w", err))
+		}
+		generations = []*storage.ObjectAttrs{attrs}
+	}
+
+	secretName := "projects/" + project + "/secrets/" + name
+
+	// Generations which a previous attempt added are skipped.
+	last, err := resourceBerglasSecretMigrationLast(ctx, smClient, secretName)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	var diags diag.Diagnostics
+	var version string
+	migrated := make([]int64, 0, len(generations))
+
+	for _, attrs := range generations {
+		if attrs.Generation <= last {
+			migrated = append(migrated, attrs.Generation)
+			continue
+		}
+
+		plaintext, err := backend.Access(ctx, bucket, object, attrs.Generation)
+		if err != nil {
+			return diag.FromErr(fmt.Errorf("failed to read generation %d: %w", attrs.Generation, err))
+		}
+
+		// Secret Manager does not allow empty versions.
+		if len(plaintext) == 0 {
+			diags = append(diags, diag.Diagnostic{
+				Severity: diag.Warning,
+				Summary:  "Skipped empty generation",
+				Detail: fmt.Sprintf("Generation %d of %q is empty and was not migrated.",
+					attrs.Generation, d.Get("source").(string)),
+			})
+			continue
+		}
+
+		start := time.Now()
+		secret, err := client.Update(ctx, &berglas.SecretManagerUpdateRequest{
+			Project:         project,
+			Name:            name,
+			Plaintext:       plaintext,
+			CreateIfMissing: true,
+		})
+		logCall(ctx, "sm_add_version", start, err, map[string]any{
+			"project":    project,
+			"name":       name,
+			"bucket":     bucket,
+			"object":     object,
+			"generation": attrs.Generation,
+		})
+		if err != nil {
+			return append(diags, diag.FromErr(fmt.Errorf("failed to migrate generation %d: %w", attrs.Generation, err))...)
+		}
+
+		version = secret.Version
+		migrated = append(migrated, attrs.Generation)
+
+		if err := resourceBerglasSecretMigrationRecord(ctx, smClient, secretName, attrs.Generation); err != nil {
+			return append(diags, diag.FromErr(err)...)
+		}
+	}
+
+	if len(migrated) == 0 {
+		return append(diags, diag.Errorf("no generations of %q were migrated", d.Get("source").(string))...)
+	}
+
+	// Every generation was added by a previous attempt.
+	if version == "" {
+		start := time.Now()
+		v, err := smClient.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{
+			Name: secretName + "/versions/latest",
+		})
+		logCall(ctx, "sm_get_secret_version", start, err, map[string]any{
+			"name": secretName,
+		})
+		if err != nil {
+			return append(diags, diag.FromErr(fmt.Errorf("failed to read latest version: %w", err))...)
+		}
+		version = v.GetName()[strings.LastIndex(v.GetName(), "/")+1:]
+	}
+
+	d.SetId(secretName)
+
+	if err := setMany(d, resourceFields{
+		"name":                 name,
+		"reference":            "sm://" + project + "/" + name,
+		"version":              version,
+		"migrated_generations": migrated,
+	}); err != nil {
+		return append(diags, diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))...)
+	}
+
+	if d.Get("delete_source").(bool) {
+		if err := backend.Delete(ctx, bucket, object); err != nil {
+			return append(diags, diag.FromErr(fmt.Errorf("failed to delete source: %w", err))...)
+		}
+	}
+
+	return append(diags, resourceBerglasSecretMigrationRead(ctx, d, meta)...)
+}
+
+func resourceBerglasSecretMigrationRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	smClient, err := config.SecretManagerClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	start := time.Now()
+	_, err = smClient.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
+		Name: d.Id(),
+	})
+	logCall(ctx, "sm_get_secret", start, err, map[string]any{
+		"name": d.Id(),
+	})
+	if isNotFound(err) {
+		id := d.Id()
+		d.SetId("")
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Secret Manager secret removed from state",
+			Detail: fmt.Sprintf("%q was deleted outside of Terraform, so it was "+
+				"removed from state and the migration will run again.", id),
+		}}
+	}
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to read secret: %w", err))
+	}
+
+	return nil
+}
+
+// resourceBerglasSecretMigrationCheckProtection returns an error if a
+// berglas_secret with deletion_protection manages the source.
+func resourceBerglasSecretMigrationCheckProtection(ctx context.Context, backend backend, bucket, object string) diag.Diagnostics {
+	attrs, err := backend.Attrs(ctx, bucket, object, 0)
+	if err != nil {
+		return apiErrorDiagnostics("read source metadata", err)
+	}
+	if attrs.Metadata[metadataDeletionProtection] != "true" {
+		return nil
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Error,
+		Summary:  "Source has deletion protection",
+		Detail: fmt.Sprintf("Cannot delete %q after migrating it because a "+
+			"berglas_secret with deletion_protection manages it. Set "+
+			"deletion_protection = false on the berglas_secret and apply before "+
+			"migrating with delete_source.",
+			encodeId(bucket, object, 0)),
+		AttributePath: cty.GetAttrPath("delete_source"),
+	}}
+}
+
+// resourceBerglasSecretMigrationLast returns the newest generation recorded as
+// migrated on the Secret Manager secret, or 0 if the secret does not exist.
+func resourceBerglasSecretMigrationLast(ctx context.Context, smClient *secretmanager.Client, name string) (int64, error) {
+	start := time.Now()
+	secret, err := smClient.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
+		Name: name,
+	})
+	logCall(ctx, "sm_get_secret", start, err, map[string]any{
+		"name": name,
+	})
+	if isNotFound(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read secret: %w", err)
+	}
+	return parseMigratedGeneration(secret.GetLabels())
+}
+
+// parseMigratedGeneration returns the generation in the labels of a Secret
+// Manager secret, or 0 if there is none.
+func parseMigratedGeneration(labels map[string]string) (int64, error) {
+	v, ok := labels[labelMigratedGeneration]
+	if !ok {
+		return 0, nil
+	}
+	generation, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s label %q: %w", labelMigratedGeneration, v, err)
+	}
+	return generation, nil
+}
+
+// resourceBerglasSecretMigrationRecord records generation as the newest
+// migrated generation in the labels of the Secret Manager secret.
+func resourceBerglasSecretMigrationRecord(ctx context.Context, smClient *secretmanager.Client, name string, generation int64) error {
+	start := time.Now()
+	secret, err := smClient.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{
+		Name: name,
+	})
+	logCall(ctx, "sm_get_secret", start, err, map[string]any{
+		"name": name,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	labels := make(map[string]string, len(secret.GetLabels())+1)
+	for k, v := range secret.GetLabels() {
+		labels[k] = v
+	}
+	labels[labelMigratedGeneration] = strconv.FormatInt(generation, 10)
+
+	start = time.Now()
+	_, err = smClient.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+		Secret: &secretmanagerpb.Secret{
+			Name:   name,
+			Labels: labels,
+			Etag:   secret.GetEtag(),
+		},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"labels"}},
+	})
+	logCall(ctx, "sm_update_secret", start, err, map[string]any{
+		"name":       name,
+		"generation": generation,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record migrated generation %d: %w", generation, err)
+	}
+	return nil
+}
+
+func resourceBerglasSecretMigrationDelete(_ context.Context, d *schema.ResourceData, _ any) diag.Diagnostics {
+	// The Secret Manager secret is now the source of truth, so it is not
+	// deleted with the migration.
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestAccBerglasSecretMigration_basic(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	project := testAccProject(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	rn := "berglas_secret_migration.test"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretMigrationDestroy(t, project, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecretMigration_basic(t, bucket, name, key, project),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr(rn, "name", name),
+					resource.TestCheckResourceAttr(rn, "reference", "sm://"+project+"/"+name),
+					resource.TestCheckResourceAttr(rn, "migrated_generations.#", "1"),
+					resource.TestCheckResourceAttrPair(rn, "migrated_generations.0", "berglas_secret.test", "generation"),
+					resource.TestCheckResourceAttrSet(rn, "version"),
+				),
+			},
+		},
+	})
+}
+
+// testAccBerglasSecretMigrationDestroy deletes the Secret Manager secret, which
+// is intentionally left behind when the migration is destroyed.
+func testAccBerglasSecretMigrationDestroy(t testing.TB, project, name string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if err := berglas.Delete(context.Background(), &berglas.SecretManagerDeleteRequest{
+			Project: project,
+			Name:    name,
+		}); err != nil {
+			return fmt.Errorf("failed to delete migrated secret: %w", err)
+		}
+		return nil
+	}
+}
+
+func testBerglasSecretMigration_basic(t testing.TB, bucket, name, key, project string) string {
+	return testBerglasSecret_plaintext(t, bucket, name, key, "super-secret") + fmt.Sprintf(`
+
+resource "berglas_secret_migration" "test" {
+	source  = berglas_secret.test.id
+	project = "%s"
+}`, project)
+}
+
+func TestResourceBerglasSecretMigrationCreate_deletionProtection(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	meta := &config{backend: testLocalBackend(t)}
+
+	secret := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+	if diags := resourceBerglasSecretCreate(ctx, secret, meta); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretMigration().Schema, map[string]any{
+		"source":        "my-bucket/my-secret",
+		"project":       "my-project",
+		"delete_source": true,
+	})
+
+	// The local backend has no Secret Manager client, so this fails later if
+	// the protection is not checked first.
+	diags := resourceBerglasSecretMigrationCreate(ctx, d, meta)
+	if !diags.HasError() {
+		t.Fatal("expected error")
+	}
+	if got, want := diags[0].Summary, "Source has deletion protection"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestParseMigratedGeneration(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		labels map[string]string
+		want   int64
+		err    bool
+	}{
+		{"none", nil, 0, false},
+		{"other_labels", map[string]string{"team": "payments"}, 0, false},
+		{"recorded", map[string]string{labelMigratedGeneration: "1700000000000000"}, 1700000000000000, false},
+		{"invalid", map[string]string{labelMigratedGeneration: "latest"}, 0, true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := parseMigratedGeneration(tc.labels)
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %d to be %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResourceBerglasSecretMigrationDiff_name(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		source string
+		secret string
+		err    bool
+	}{
+		{"derived", "my-bucket/app/db-password", "", false},
+		{"derived_invalid", "my-bucket/app/db.password", "", true},
+		{"explicit", "my-bucket/app/db.password", "db-password", false},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			raw := map[string]any{
+				"source":  tc.source,
+				"project": "my-project",
+			}
+			if tc.secret != "" {
+				raw["name"] = tc.secret
+			}
+
+			// Like a plan, pass the raw configuration in the prior state.
+			r := resourceBerglasSecretMigration()
+			vals := make(map[string]cty.Value)
+			for k, typ := range r.CoreConfigSchema().ImpliedType().AttributeTypes() {
+				vals[k] = cty.NullVal(typ)
+				if v, ok := raw[k]; ok {
+					vals[k] = cty.StringVal(v.(string))
+				}
+			}
+			state := &terraform.InstanceState{RawConfig: cty.ObjectVal(vals)}
+
+			_, err := r.Diff(context.Background(), state, terraform.NewResourceConfigRaw(raw), &config{})
+			if (err != nil) != tc.err {
+				t.Fatalf("expected error to be %t, got %v", tc.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"cloud.google.com/go/storage"
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func resourceBerglasSecretRestore() *schema.Resource {
+	return &schema.Resource{
+		Description: "Restore a generation of a Berglas secret as the live " +
+			"generation. Noncurrent generations, which are kept when the bucket " +
+			"has object versioning enabled, are copied over the live generation. " +
+			"Soft-deleted generations are restored. The generation must decrypt " +
+			"with the key recorded in its metadata, which is checked before it is " +
+			"restored, and must be allowed by `allowed_kms_keys`. Soft-deleted " +
+			"generations cannot be read, so only their key version is checked " +
+			"before they are restored. Destroying this resource does not undo the " +
+			"restore.",
+
+		CreateContext: resourceBerglasSecretRestoreCreate,
+		ReadContext:   resourceBerglasSecretRestoreRead,
+		DeleteContext: resourceBerglasSecretRestoreDelete,
+
+		CustomizeDiff: func(_ context.Context, d *schema.ResourceDiff, meta any) error {
+			return checkGuardrailsDiff(d, meta, "bucket", "name", "")
+		},
+
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:        schema.TypeString,
+				Description: "Name of the Cloud Storage bucket for the secret",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validateBucket,
+			},
+
+			"name": {
+				Type:        schema.TypeString,
+				Description: "Name of the secret object in the bucket",
+				ForceNew:    true,
+				Required:    true,
+			},
+
+			"generation": {
+				Type:        schema.TypeInt,
+				Description: "Noncurrent or soft-deleted generation to restore",
+				ForceNew:    true,
+				Required:    true,
+
+				ValidateDiagFunc: validation.ToDiagFunc(validation.IntAtLeast(1)),
+			},
+
+			//
+			// Computed
+			//
+			"id": {
+				Type:        schema.TypeString,
+				Description: "ID of the restored secret in the format `{bucket}/{name}#{generation}`",
+				Computed:    true,
+			},
+
+			"restored_generation": {
+				Type:        schema.TypeInt,
+				Description: "Live generation which was created by the restore",
+				Computed:    true,
+			},
+
+			"metageneration": {
+				Type:        schema.TypeInt,
+				Description: "Metageneration of the restored generation",
+				Computed:    true,
+			},
+
+			"key": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key which encrypts the restored secret",
+				Computed:    true,
+			},
+
+			"kms_key_version": {
+				Type:        schema.TypeString,
+				Description: "Fully-qualified name of the Cloud KMS key version which encrypted the restored secret",
+				Computed:    true,
+			},
+		},
+	}
+}
+
+func resourceBerglasSecretRestoreCreate(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	if diags := readOnlyDiagnostics(config, "create", "berglas_secret_restore"); diags != nil {
+		return diags
+	}
+	if diags := guardrailsDiagnostics(d, meta, "bucket", "name", ""); diags != nil {
+		return diags
+	}
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket := sanitizeBucket(d.Get("bucket").(string))
+	name := sanitizeObject(d.Get("name").(string))
+	generation := int64(d.Get("generation").(int))
+
+	// Noncurrent generations can be read directly, but soft-deleted ones only
+	// have metadata until they are restored.
+	target, err := backend.Attrs(ctx, bucket, name, generation)
+	softDeleted := isNotFound(err)
+	if softDeleted {
+		target, err = backend.SoftDeletedAttrs(ctx, bucket, name, generation)
+	}
+	if err != nil {
+		return apiErrorDiagnostics(fmt.Sprintf("read generation %d", generation), err)
+	}
+
+	// The key is only known from the generation's metadata, so the guardrails
+	// cannot check it at plan time.
+	if err := d.Set("key", target.Metadata[berglas.MetadataKMSKey]); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to set key: %w", err))
+	}
+	if diags := guardrailsDiagnostics(d, meta, "", "", "key"); diags != nil {
+		return diags
+	}
+
+	// Check the generation decrypts before it is promoted. A soft-deleted
+	// generation cannot be read, so check its key version instead, and
+	// decrypt it once it is restored.
+	if softDeleted {
+		if v := target.Metadata[metadataKMSKeyVersion]; v != "" {
+			version, err := backend.KeyVersion(ctx, v)
+			if err != nil {
+				return apiErrorDiagnostics("read key version", err)
+			}
+			// A nil version means the caller cannot view it.
+			if version != nil && version.GetState() != kmspb.CryptoKeyVersion_ENABLED {
+				return resourceBerglasSecretRestoreDecryptDiagnostics(bucket, name, generation, target,
+					fmt.Errorf("key version %q is %s", v, version.GetState()), false)
+			}
+		}
+	} else if _, err := backend.Access(ctx, bucket, name, generation); err != nil {
+		return resourceBerglasSecretRestoreDecryptDiagnostics(bucket, name, generation, target, err, false)
+	}
+
+	attrs, err := backend.Restore(ctx, bucket, name, generation)
+	if err != nil {
+		return apiErrorDiagnostics(fmt.Sprintf("restore generation %d", generation), err)
+	}
+
+	if softDeleted {
+		if _, err := backend.Access(ctx, bucket, name, attrs.Generation); err != nil {
+			return resourceBerglasSecretRestoreDecryptDiagnostics(bucket, name, generation, target, err, true)
+		}
+	}
+
+	d.SetId(encodeId(bucket, name, attrs.Generation))
+
+	if err := setMany(d, resourceFields{
+		"restored_generation": attrs.Generation,
+		"metageneration":      attrs.Metageneration,
+		"key":                 attrs.Metadata[berglas.MetadataKMSKey],
+		"kms_key_version":     attrs.Metadata[metadataKMSKeyVersion],
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return resourceBerglasSecretRestoreRead(ctx, d, meta)
+}
+
+// resourceBerglasSecretRestoreDecryptDiagnostics explains that a generation
+// cannot be decrypted. If restored is true, the generation is already live.
+func resourceBerglasSecretRestoreDecryptDiagnostics(bucket, name string, generation int64,
+	target *storage.ObjectAttrs, err error, restored bool) diag.Diagnostics {
+	detail := fmt.Sprintf("Generation %d of %q does not decrypt with %q: %s. It "+
+		"was not restored; restore another generation instead.",
+		generation, encodeId(bucket, name, 0), target.Metadata[berglas.MetadataKMSKey], err)
+	if restored {
+		detail = fmt.Sprintf("Generation %d of %q was soft-deleted, so it could "+
+			"only be decrypted after it was restored, and it does not decrypt with "+
+			"%q: %s. The restored generation is live; write a new generation or "+
+			"restore another one.",
+			generation, encodeId(bucket, name, 0), target.Metadata[berglas.MetadataKMSKey], err)
+	}
+
+	return diag.Diagnostics{{
+		Severity:      diag.Error,
+		Summary:       "Secret generation cannot be decrypted",
+		Detail:        detail,
+		AttributePath: cty.GetAttrPath("generation"),
+	}}
+}
+
+func resourceBerglasSecretRestoreRead(ctx context.Context, d *schema.ResourceData, meta any) diag.Diagnostics {
+	config := meta.(*config)
+	backend, err := config.Backend(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	bucket, object, generation, err := decodeId(d.Id())
+	if err != nil {
+		return diag.FromErr(fmt.Errorf("failed to decode id: %w", err))
+	}
+
+	// Removing the resource from state would restore the generation again on
+	// the next apply, so only warn if the restored generation was deleted.
+	attrs, err := backend.Attrs(ctx, bucket, object, generation)
+	if isNotFound(err) {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "Restored generation no longer exists",
+			Detail: fmt.Sprintf("Generation %d of %q was deleted after it was restored.",
+				generation, encodeId(bucket, object, 0)),
+		}}
+	}
+	if err != nil {
+		return apiErrorDiagnostics("read restored generation", err)
+	}
+
+	if err := setMany(d, resourceFields{
+		"metageneration": attrs.Metageneration,
+	}); err != nil {
+		return diag.FromErr(fmt.Errorf("failed to update resource fields: %w", err))
+	}
+
+	return nil
+}
+
+func resourceBerglasSecretRestoreDelete(_ context.Context, d *schema.ResourceData, _ any) diag.Diagnostics {
+	// Restoring cannot be undone, and the restored secret is managed elsewhere.
+	d.SetId("")
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestResourceBerglasSecretRestoreCreate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	created, err := backend.Create(ctx, "my-bucket", "my-secret", testLocalKey, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := backend.Update(ctx, "my-bucket", "my-secret", testLocalKey, []byte("after"),
+		created.Generation, created.Metageneration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretRestore().Schema, map[string]any{
+		"bucket":     "my-bucket",
+		"name":       "my-secret",
+		"generation": int(created.Generation),
+	})
+
+	if diags := resourceBerglasSecretRestoreCreate(ctx, d, &config{backend: backend}); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	restored := int64(d.Get("restored_generation").(int))
+	if restored <= updated.Generation {
+		t.Errorf("expected generation %d to be after %d", restored, updated.Generation)
+	}
+	if got, want := d.Id(), encodeId("my-bucket", "my-secret", restored); got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := d.Get("key").(string), testLocalKey; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+
+	plaintext, err := backend.Access(ctx, "my-bucket", "my-secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(plaintext), "before"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+func TestResourceBerglasSecretRestoreCreate_missing(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretRestore().Schema, map[string]any{
+		"bucket":     "my-bucket",
+		"name":       "my-secret",
+		"generation": 1,
+	})
+
+	diags := resourceBerglasSecretRestoreCreate(context.Background(), d, &config{backend: testLocalBackend(t)})
+	if !diags.HasError() {
+		t.Fatal("expected error")
+	}
+	if got, want := diags[0].Summary, "Secret not found"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if d.Id() != "" {
+		t.Errorf("expected no id, got %q", d.Id())
+	}
+}
+
+func TestResourceBerglasSecretRestoreCreate_undecryptable(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	created, err := backend.Create(ctx, "my-bucket", "my-secret", testLocalKey, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record the wrong key, so the generation no longer decrypts
+	if _, err := backend.PatchMetadata(ctx, "my-bucket", "my-secret", created.Generation, created.Metageneration,
+		map[string]string{berglas.MetadataKMSKey: testLocalKey + "-other"}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := backend.Update(ctx, "my-bucket", "my-secret", testLocalKey, []byte("after"),
+		created.Generation, created.Metageneration+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretRestore().Schema, map[string]any{
+		"bucket":     "my-bucket",
+		"name":       "my-secret",
+		"generation": int(created.Generation),
+	})
+
+	if diags := resourceBerglasSecretRestoreCreate(ctx, d, &config{backend: backend}); !diags.HasError() {
+		t.Fatal("expected error")
+	}
+	if d.Id() != "" {
+		t.Errorf("expected no id, got %q", d.Id())
+	}
+
+	// The generation was not promoted
+	live, err := backend.Attrs(ctx, "my-bucket", "my-secret", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := live.Generation, updated.Generation; got != want {
+		t.Errorf("expected generation %d to be %d", got, want)
+	}
+}
+
+func TestResourceBerglasSecretRestoreCreate_guardrails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	created, err := backend.Create(ctx, "my-bucket", "my-secret", testLocalKey, []byte("before"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := newGuardrails(nil, nil, []string{testLocalKey + "-other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecretRestore().Schema, map[string]any{
+		"bucket":     "my-bucket",
+		"name":       "my-secret",
+		"generation": int(created.Generation),
+	})
+
+	diags := resourceBerglasSecretRestoreCreate(ctx, d, &config{backend: backend, guardrails: g})
+	if !diags.HasError() {
+		t.Fatal("expected error")
+	}
+	if got, want := diags[0].Summary, "Blocked by provider guardrails"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceBerglasSecretV0 is the schema for version 0 of the resource, where
+// the ID was in the format {bucket}/{object}#{generation}.
+func resourceBerglasSecretV0() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"bucket": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+
+			"name": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+
+			"key": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+
+			"plaintext": {
+				Type:      schema.TypeString,
+				Required:  true,
+				Sensitive: true,
+			},
+
+			"generation": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+
+			"metageneration": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+// resourceBerglasSecretStateUpgradeV0 moves the generation out of the ID and
+// into the generation attribute.
+func resourceBerglasSecretStateUpgradeV0(_ context.Context, rawState map[string]any, _ any) (map[string]any, error) {
+	if rawState == nil {
+		return nil, nil
+	}
+
+	id, _ := rawState["id"].(string)
+	bucket, object, generation, err := decodeId(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode id: %w", err)
+	}
+
+	rawState["id"] = encodeId(bucket, object, 0)
+
+	// Older states may not have recorded the generation attribute.
+	if current, _ := rawState["generation"].(float64); current == 0 && generation > 0 {
+		rawState["generation"] = generation
+	}
+
+	return rawState, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Seth Vargo
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestResourceBerglasSecretStateUpgradeV0(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		in   map[string]any
+		exp  map[string]any
+	}{
+		{
+			name: "generation_in_id",
+			in: map[string]any{
+				"id":         "my-bucket/my-secret#1234",
+				"generation": float64(1234),
+			},
+			exp: map[string]any{
+				"id":         "my-bucket/my-secret",
+				"generation": float64(1234),
+			},
+		},
+		{
+			name: "missing_generation",
+			in: map[string]any{
+				"id": "my-bucket/my-secret#1234",
+			},
+			exp: map[string]any{
+				"id":         "my-bucket/my-secret",
+				"generation": int64(1234),
+			},
+		},
+		{
+			name: "no_generation",
+			in: map[string]any{
+				"id": "my-bucket/path/to/secret",
+			},
+			exp: map[string]any{
+				"id": "my-bucket/path/to/secret",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := resourceBerglasSecretStateUpgradeV0(context.Background(), tc.in, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tc.exp) {
+				t.Errorf("expected %#v to be %#v", got, tc.exp)
+			}
+		})
+	}
+}
@@ -17,12 +17,16 @@ package provider
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"testing"
 
 	"github.com/GoogleCloudPlatform/berglas/pkg/berglas"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestAccBerglasSecret_basic(t *testing.T) {
@@ -44,12 +48,519 @@ func TestAccBerglasSecret_basic(t *testing.T) {
 					resource.TestCheckResourceAttr("berglas_secret.test", "bucket", bucket),
 					resource.TestCheckResourceAttr("berglas_secret.test", "name", name),
 					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext", "super-secret"),
+					resource.TestCheckResourceAttrSet("berglas_secret.test", "kms_key_version"),
+					resource.TestCheckResourceAttr("berglas_secret.test", "kms_key_version_state", "ENABLED"),
 				),
 			},
 			{
 				ResourceName:      "berglas_secret.test",
 				ImportState:       true,
 				ImportStateVerify: true,
+
+				// Imported secrets are always protected.
+				ImportStateVerifyIgnore: []string{"deletion_protection"},
+			},
+		},
+	})
+}
+
+func TestAccBerglasSecret_update(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	var generation, dependent string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_dependent(t, bucket, name, key, "before"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext", "before"),
+					resource.TestCheckResourceAttrPair("terraform_data.dependent", "input",
+						"berglas_secret.test", "generation"),
+					func(s *terraform.State) error {
+						generation = s.RootModule().Resources["berglas_secret.test"].Primary.Attributes["generation"]
+						dependent = s.RootModule().Resources["terraform_data.dependent"].Primary.ID
+						return nil
+					},
+				),
+			},
+			{
+				// An unchanged plaintext keeps the generation known, so the
+				// dependent resource is not replaced
+				Config:   testBerglasSecret_dependent(t, bucket, name, key, "before"),
+				PlanOnly: true,
+			},
+			{
+				// A changed plaintext makes the generation unknown at plan time,
+				// which is the only way the dependent resource is replaced in the
+				// same apply
+				Config: testBerglasSecret_dependent(t, bucket, name, key, "after"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext", "after"),
+					resource.TestCheckResourceAttrPair("terraform_data.dependent", "input",
+						"berglas_secret.test", "generation"),
+					func(s *terraform.State) error {
+						got := s.RootModule().Resources["berglas_secret.test"].Primary.Attributes["generation"]
+						if got == generation {
+							return fmt.Errorf("expected generation to change from %s", generation)
+						}
+
+						if id := s.RootModule().Resources["terraform_data.dependent"].Primary.ID; id == dependent {
+							return fmt.Errorf("expected terraform_data.dependent to be replaced, " +
+								"generation was not unknown at plan time")
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccBerglasSecret_ttl(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_ttl(t, bucket, name, key, "720h"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "ttl", "720h"),
+					resource.TestCheckResourceAttrSet("berglas_secret.test", "expires_at"),
+				),
+			},
+			{
+				Config: testDataBerglasExpiringSecrets(t, bucket, name, key),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.berglas_expiring_secrets.test", "secrets.#", "1"),
+					resource.TestCheckResourceAttr("data.berglas_expiring_secrets.test", "secrets.0.name", name),
+					resource.TestCheckResourceAttr("data.berglas_expiring_secrets.test", "secrets.0.expired", "false"),
+				),
+			},
+			{
+				// Removing ttl removes the expiration
+				Config: testBerglasSecret_basic(t, bucket, name, key),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "expires_at", ""),
+				),
+			},
+			{
+				Config: testBerglasSecret_expiresAt(t, bucket, name, key, "2099-01-01T00:00:00Z"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "expires_at", "2099-01-01T00:00:00Z"),
+				),
+			},
+			{
+				// Removing expires_at removes the expiration
+				Config: testBerglasSecret_basic(t, bucket, name, key),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "expires_at", ""),
+				),
+			},
+		},
+	})
+}
+
+func TestAccBerglasSecret_rotation(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_rotation(t, bucket, name, key),
+				Check: resource.ComposeTestCheckFunc(
+					testAccBerglasSecret(t, bucket, name),
+					resource.TestCheckResourceAttrSet("berglas_secret.test", "plaintext"),
+					resource.TestCheckResourceAttrSet("berglas_secret.test", "rotated_at"),
+					resource.TestCheckResourceAttrSet("berglas_secret.test", "next_rotation_at"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccBerglasSecret_deletionProtection(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_deletionProtection(t, bucket, name, key, true),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "deletion_protection", "true"),
+				),
+			},
+			{
+				Config:      testBerglasSecret_deletionProtection(t, bucket, name, key, true),
+				Destroy:     true,
+				ExpectError: regexp.MustCompile(`deletion_protection is enabled`),
+			},
+			{
+				Config:      testBerglasSecret_deletionProtection(t, bucket, name+"-renamed", key, true),
+				ExpectError: regexp.MustCompile(`cannot replace`),
+			},
+			{
+				Config: testBerglasSecret_deletionProtection(t, bucket, name, key, false),
+				Check: resource.ComposeTestCheckFunc(
+					testAccBerglasSecret(t, bucket, name),
+					resource.TestCheckResourceAttr("berglas_secret.test", "deletion_protection", "false"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceBerglasSecretDelete_deletionProtection(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       "projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		"plaintext": "value",
+	})
+	d.SetId("my-bucket/my-secret")
+
+	// The backend is nil, so this panics if the secret is deleted.
+	diags := resourceBerglasSecretDelete(context.Background(), d, &config{})
+	if !diags.HasError() {
+		t.Errorf("expected error, got %#v", diags)
+	}
+}
+
+func TestResourceBerglasSecretRead_missing(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+	d.SetId("my-bucket/my-secret")
+
+	diags := resourceBerglasSecretRead(context.Background(), d, &config{backend: testLocalBackend(t)})
+	if diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got := d.Id(); got != "" {
+		t.Errorf("expected %q to be removed from state", got)
+	}
+	if got, want := len(diags), 1; got != want {
+		t.Errorf("expected %d diagnostics to be %d", got, want)
+	}
+}
+
+// missingKeyBackend fails to decrypt secrets as if their Cloud KMS key was
+// deleted.
+type missingKeyBackend struct {
+	backend
+}
+
+func (b *missingKeyBackend) Access(ctx context.Context, bucket, object string, generation int64) ([]byte, error) {
+	return nil, fmt.Errorf("failed to decrypt dek: %w", status.Error(codes.NotFound, "key not found"))
+}
+
+func TestResourceBerglasSecretRead_missingKey(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+	if diags := resourceBerglasSecretCreate(ctx, d, &config{backend: backend}); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	diags := resourceBerglasSecretRead(ctx, d, &config{backend: &missingKeyBackend{backend: backend}})
+	if diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got := d.Id(); got != "" {
+		t.Errorf("expected %q to be removed from state", got)
+	}
+	if got, want := len(diags), 1; got != want {
+		t.Errorf("expected %d diagnostics to be %d", got, want)
+	}
+}
+
+func TestResourceBerglasSecretRead_expired(t *testing.T) {
+	t.Parallel()
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":     "my-bucket",
+		"name":       "my-secret",
+		"key":        testLocalKey,
+		"plaintext":  "value",
+		"expires_at": "2020-01-01T00:00:00Z",
+	})
+
+	// An expired secret must not block the apply which rotates it
+	diags := resourceBerglasSecretCreate(context.Background(), d, &config{backend: testLocalBackend(t)})
+	if diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got, want := len(diags), 1; got != want {
+		t.Errorf("expected %d diagnostics to be %d", got, want)
+	}
+}
+
+func TestResourceBerglasSecretRead_outOfBand(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := testLocalBackend(t)
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+	if diags := resourceBerglasSecretCreate(ctx, d, &config{backend: backend}); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+
+	updated, err := backend.Update(ctx, "my-bucket", "my-secret", testLocalKey, []byte("changed"),
+		int64(d.Get("generation").(int)), int64(d.Get("metageneration").(int)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refresh follows the live generation instead of the one in state
+	if diags := resourceBerglasSecretRead(ctx, d, &config{backend: backend}); diags.HasError() {
+		t.Fatalf("expected no error, got %#v", diags)
+	}
+	if got, want := d.Id(), "my-bucket/my-secret"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+	if got, want := int64(d.Get("generation").(int)), updated.Generation; got != want {
+		t.Errorf("expected generation %d to be %d", got, want)
+	}
+	if got, want := d.Get("plaintext").(string), "changed"; got != want {
+		t.Errorf("expected %q to be %q", got, want)
+	}
+}
+
+// deniedBackend reports that the caller has none of the permissions needed to
+// write secrets.
+type deniedBackend struct {
+	backend
+}
+
+func (b *deniedBackend) MissingBucketPermissions(ctx context.Context, bucket string) ([]string, error) {
+	return bucketPermissions, nil
+}
+
+func (b *deniedBackend) MissingKeyPermissions(ctx context.Context, key string) ([]string, error) {
+	return keyPermissions, nil
+}
+
+func TestResourceBerglasSecretDiff_readOnly(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	backend := &deniedBackend{backend: testLocalBackend(t)}
+
+	raw := terraform.NewResourceConfigRaw(map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "value",
+	})
+
+	if _, err := resourceBerglasSecret().Diff(ctx, nil, raw, &config{backend: backend}); err == nil {
+		t.Error("expected missing permissions to fail the plan")
+	}
+
+	// A read-only provider plans without checking permissions
+	if _, err := resourceBerglasSecret().Diff(ctx, nil, raw, &config{backend: backend, readOnly: true}); err != nil {
+		t.Errorf("expected read-only plan to succeed, got %v", err)
+	}
+}
+
+func TestResourceBerglasSecretDiff_generation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	meta := &config{backend: testLocalBackend(t)}
+
+	raw := map[string]any{
+		"bucket":    "my-bucket",
+		"name":      "my-secret",
+		"key":       testLocalKey,
+		"plaintext": "before",
+	}
+
+	d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, raw)
+	if diags := resourceBerglasSecretCreate(ctx, d, meta); diags.HasError() {
+		t.Fatalf("create: %v", diags)
+	}
+	state := d.State()
+
+	// Planning the same plaintext keeps the generation known
+	diff, err := resourceBerglasSecret().Diff(ctx, state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != nil && diff.Attributes["generation"] != nil && diff.Attributes["generation"].NewComputed {
+		t.Errorf("expected generation to be known in a no-op plan, got %#v", diff.Attributes["generation"])
+	}
+
+	// Planning a new plaintext makes the generation unknown
+	raw["plaintext"] = "after"
+	diff, err = resourceBerglasSecret().Diff(ctx, state, terraform.NewResourceConfigRaw(raw), meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff == nil || diff.Attributes["generation"] == nil || !diff.Attributes["generation"].NewComputed {
+		t.Errorf("expected generation to be unknown when plaintext changes, got %#v", diff)
+	}
+}
+
+func TestResourceBerglasSecretCreate_onConflict(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name       string
+		onConflict string
+		plaintext  string
+		err        bool
+		want       string
+		rewritten  bool
+	}{
+		{"error", onConflictError, "existing", true, "", false},
+		{"adopt", onConflictAdopt, "existing", false, "existing", false},
+		{"adopt_different", onConflictAdopt, "new", true, "", false},
+		{"overwrite", onConflictOverwrite, "new", false, "new", true},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			backend := testLocalBackend(t)
+			existing, err := backend.Create(ctx, "my-bucket", "my-secret", testLocalKey, []byte("existing"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d := schema.TestResourceDataRaw(t, resourceBerglasSecret().Schema, map[string]any{
+				"bucket":      "my-bucket",
+				"name":        "my-secret",
+				"key":         testLocalKey,
+				"plaintext":   tc.plaintext,
+				"on_conflict": tc.onConflict,
+			})
+
+			diags := resourceBerglasSecretCreate(ctx, d, &config{backend: backend})
+			if got := diags.HasError(); got != tc.err {
+				t.Fatalf("expected error to be %t, got %#v", tc.err, diags)
+			}
+			if tc.err {
+				return
+			}
+
+			if got, want := d.Get("plaintext").(string), tc.want; got != want {
+				t.Errorf("expected %q to be %q", got, want)
+			}
+			if got := int64(d.Get("generation").(int)) != existing.Generation; got != tc.rewritten {
+				t.Errorf("expected rewritten to be %t", tc.rewritten)
+			}
+		})
+	}
+}
+
+func TestAccBerglasSecret_json(t *testing.T) {
+	t.Parallel()
+
+	bucket := testAccBucket(t)
+	name := "terraform-" + acctest.RandString(24)
+	key := testAccKey(t)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheck(t) },
+		ProviderFactories: testProviderFactories,
+		CheckDestroy:      testAccBerglasSecretDestroy(t, bucket, name),
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_json(t, bucket, name, key, "before"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext",
+						`{"host":"db.internal","password":"before","user":"app"}`),
+					resource.TestCheckResourceAttr("data.berglas_secret.test", "json.password", "before"),
+				),
+			},
+			{
+				Config: testBerglasSecret_json(t, bucket, name, key, "after"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext_json.password", "after"),
+					resource.TestCheckResourceAttr("data.berglas_secret.test", "json.password", "after"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccBerglasSecret_local(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	name := "terraform-" + acctest.RandString(24)
+	key := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testBerglasSecret_local(t, dir, name, key, "before"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext", "before"),
+					resource.TestCheckResourceAttr("berglas_secret.test", "kms_key_version", key+"/cryptoKeyVersions/1"),
+					resource.TestCheckResourceAttr("data.berglas_secrets.test", "secrets.#", "1"),
+				),
+			},
+			{
+				Config: testBerglasSecret_local(t, dir, name, key, "after"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("berglas_secret.test", "plaintext", "after"),
+				),
 			},
 		},
 	})
@@ -57,10 +568,13 @@ func TestAccBerglasSecret_basic(t *testing.T) {
 
 func testAccBerglasSecret(t testing.TB, bucket, name string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
+		ctx := context.Background()
 		config := New("test")().Meta().(*config)
-		client := config.Client()
+		client, err := config.Client(ctx)
+		if err != nil {
+			return err
+		}
 
-		ctx := context.Background()
 		if _, err := client.Read(ctx, &berglas.ReadRequest{
 			Bucket: bucket,
 			Object: name,
@@ -74,10 +588,13 @@ func testAccBerglasSecret(t testing.TB, bucket, name string) resource.TestCheckF
 
 func testAccBerglasSecretDestroy(t testing.TB, bucket, name string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
+		ctx := context.Background()
 		config := New("test")().Meta().(*config)
-		client := config.Client()
+		client, err := config.Client(ctx)
+		if err != nil {
+			return err
+		}
 
-		ctx := context.Background()
 		if _, err := client.Read(ctx, &berglas.ReadRequest{
 			Bucket: bucket,
 			Object: name,
@@ -96,5 +613,142 @@ resource "berglas_secret" "test" {
 	name      = "%s"
 	key       = "%s"
 	plaintext = "super-secret"
+
+	deletion_protection = false
+}`, bucket, name, key)
+}
+
+func testBerglasSecret_plaintext(t testing.TB, bucket, name, key, plaintext string) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket    = "%s"
+	name      = "%s"
+	key       = "%s"
+	plaintext = "%s"
+
+	deletion_protection = false
+}`, bucket, name, key, plaintext)
+}
+
+// testBerglasSecret_dependent is testBerglasSecret_plaintext with a
+// terraform_data resource which is replaced whenever the generation is unknown
+// or changes at plan time.
+func testBerglasSecret_dependent(t testing.TB, bucket, name, key, plaintext string) string {
+	return testBerglasSecret_plaintext(t, bucket, name, key, plaintext) + `
+
+resource "terraform_data" "dependent" {
+	input            = berglas_secret.test.generation
+	triggers_replace = berglas_secret.test.generation
+}`
+}
+
+func testBerglasSecret_deletionProtection(t testing.TB, bucket, name, key string, protect bool) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket    = "%s"
+	name      = "%s"
+	key       = "%s"
+	plaintext = "super-secret"
+
+	deletion_protection = %t
+}`, bucket, name, key, protect)
+}
+
+func testBerglasSecret_json(t testing.TB, bucket, name, key, password string) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket = "%s"
+	name   = "%s"
+	key    = "%s"
+
+	plaintext_json = {
+		user     = "app"
+		password = "%s"
+		host     = "db.internal"
+	}
+
+	deletion_protection = false
+}
+
+data "berglas_secret" "test" {
+	bucket     = berglas_secret.test.bucket
+	name       = berglas_secret.test.name
+	generation = berglas_secret.test.generation
+}`, bucket, name, key, password)
+}
+
+func testBerglasSecret_local(t testing.TB, dir, name, key, plaintext string) string {
+	return fmt.Sprintf(`
+provider "berglas" {
+	backend         = "local"
+	local_directory = "%s"
+}
+
+resource "berglas_secret" "test" {
+	bucket    = "local-bucket"
+	name      = "%s"
+	key       = "%s"
+	plaintext = "%s"
+
+	deletion_protection = false
+}
+
+data "berglas_secrets" "test" {
+	bucket = berglas_secret.test.bucket
+}`, dir, name, key, plaintext)
+}
+
+func testBerglasSecret_ttl(t testing.TB, bucket, name, key, ttl string) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket    = "%s"
+	name      = "%s"
+	key       = "%s"
+	plaintext = "super-secret"
+	ttl       = "%s"
+
+	deletion_protection = false
+}`, bucket, name, key, ttl)
+}
+
+func testBerglasSecret_expiresAt(t testing.TB, bucket, name, key, expiresAt string) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket     = "%s"
+	name       = "%s"
+	key        = "%s"
+	plaintext  = "super-secret"
+	expires_at = "%s"
+
+	deletion_protection = false
+}`, bucket, name, key, expiresAt)
+}
+
+func testDataBerglasExpiringSecrets(t testing.TB, bucket, name, key string) string {
+	return testBerglasSecret_ttl(t, bucket, name, key, "720h") + fmt.Sprintf(`
+data "berglas_expiring_secrets" "test" {
+	bucket = "%s"
+	prefix = "%s"
+	within = "744h"
+
+	depends_on = [berglas_secret.test]
+}`, bucket, name)
+}
+
+func testBerglasSecret_rotation(t testing.TB, bucket, name, key string) string {
+	return fmt.Sprintf(`
+resource "berglas_secret" "test" {
+	bucket = "%s"
+	name   = "%s"
+	key    = "%s"
+
+	generator {
+		length  = 24
+		special = false
+	}
+
+	rotation_period = "2160h"
+
+	deletion_protection = false
 }`, bucket, name, key)
 }